@@ -0,0 +1,298 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Ways of wiring the agent's stdin (--stdin).
+const (
+	stdinInherit = "inherit" // share our terminal; a human can answer aider's questions
+	stdinNull    = "null"    // no input; interactive prompts fail the iteration
+	stdinPTY     = "pty"     // run aider on a pseudo-terminal (colors, progress output)
+)
+
+// agentResult is the captured outcome of a single aider invocation.
+type agentResult struct {
+	Output     string
+	TimedOut   bool
+	Err        error  // aider could not be started
+	Prompt     string // interactive prompt aider was stuck on (the iteration was aborted)
+	PromptKind string
+	ReadErr    error // reading aider's output failed part way (output may be incomplete)
+	ExitCode   int   // aider's exit code (-1 if it was killed by a signal)
+
+	Status       string // last status seen while streaming ("" if none)
+	StatusReason string
+	Termination  string // how aider ended after reporting a status ("" if it never did)
+}
+
+// status returns the status aider reported. It is normally picked up as it
+// streams by; the full output is only searched when the stream detector saw
+// none, e.g. for a tag block larger than its window.
+func (r agentResult) status() (string, string) {
+	if r.Status != "" {
+		return r.Status, r.StatusReason
+	}
+	status, reason := extractStatus(r.Output)
+	if status == "" && checkCompletion(r.Output) {
+		status = statusCompleted
+	}
+	return status, reason
+}
+
+// How aider ended once a status tag had streamed by (--early-stop).
+const (
+	terminationNatural = "natural"             // ran to completion (no --early-stop)
+	terminationExited  = "exited_within_grace" // exited on its own within the grace period
+	terminationStopped = "stopped_after_grace" // still running after the grace period; stopped
+)
+
+// earlyStopKillDelay is how long aider gets to exit after an interrupt
+// before it is killed.
+const earlyStopKillDelay = 5 * time.Second
+
+// promptSettleTime is how long output must stay idle on an unterminated
+// line before it is checked for an interactive prompt.
+const promptSettleTime = 2 * time.Second
+
+// interactivePrompts are the questions aider leaves on an unterminated line
+// while it waits for an answer an unattended run will never give. Only that
+// tail is checked: a complete line is ordinary output (model text, or a
+// prompt --yes has already answered, e.g. "... [Yes]: y").
+var interactivePrompts = []struct {
+	kind string
+	re   *regexp.Regexp
+}{
+	{"confirmation", regexp.MustCompile(`\(Y\)es/\(N\)o.*\[[^\]]*\]:\s*$`)},
+	{"confirmation", regexp.MustCompile(`\?\s*\[[yY]/[nN]\]:?\s*$`)},
+	{"press_enter", regexp.MustCompile(`(?i)^\s*press enter to [^.!?]*(\.\.\.|[.:])?\s*$`)},
+	{"credentials", regexp.MustCompile(`(?i)^\s*(enter|paste) (your |the )?[\w .-]*(api key|password|token):\s*$`)},
+	{"login", regexp.MustCompile(`(?i)^\s*login to \w+.*\?\s*$`)},
+}
+
+// detectInteractivePrompt classifies the unterminated tail of aider's output
+// if it is waiting for input, returning "" if it is ordinary output.
+func detectInteractivePrompt(line string) string {
+	for _, p := range interactivePrompts {
+		if p.re.MatchString(line) {
+			return p.kind
+		}
+	}
+	return ""
+}
+
+// promptWatcher spots an interactive prompt in streamed output. Prompts
+// never end in a newline, so only the unterminated tail is checked, once
+// output has been idle on it for settle; a prompt that --yes answers on the
+// same line is not mistaken for a hang.
+type promptWatcher struct {
+	settle   time.Duration
+	onPrompt func(line, kind string)
+
+	mu   sync.Mutex
+	idle *time.Timer
+}
+
+// partial is called with the unterminated tail after each read.
+func (w *promptWatcher) partial(tail string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.idle != nil {
+		w.idle.Stop()
+	}
+	w.idle = time.AfterFunc(w.settle, func() {
+		if kind := detectInteractivePrompt(tail); kind != "" {
+			w.onPrompt(tail, kind)
+		}
+	})
+}
+
+// line is called for each complete line (and when output ends): the tail
+// being watched was not a prompt after all.
+func (w *promptWatcher) line() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.idle != nil {
+		w.idle.Stop()
+		w.idle = nil
+	}
+}
+
+// runAgent runs aider with the given arguments, streaming its combined
+// output to the terminal (and logWriter, if set) while capturing it.
+// The process is killed if it exceeds the configured timeout.
+//
+// In pty mode aider sees a terminal and produces its rich output, which is
+// passed to our terminal as-is; the captured output and log get plain text.
+func runAgent(args []string, logWriter io.Writer) (result agentResult) {
+	agentSpan := startSpan("agent")
+	defer func() { endAgentSpan(agentSpan, result) }()
+
+	// Create context with timeout
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(config.Timeout)*time.Second)
+	defer cancel()
+
+	// Run aider with context
+	cmd := exec.CommandContext(ctx, "aider", args...)
+	if config.StdinMode == stdinInherit {
+		cmd.Stdin = os.Stdin
+	}
+	// Otherwise stdin is left nil, i.e. connected to the null device
+
+	// Capture output while also displaying it
+	var stdout io.Reader
+	if config.StdinMode == stdinPTY {
+		master, slave, err := openPTY()
+		if err != nil {
+			logError(fmt.Sprintf("Failed to open pseudo-terminal: %v", err))
+			return agentResult{Err: err}
+		}
+		defer master.Close()
+		attachPTY(cmd, slave)
+		stdout = master
+
+		err = cmd.Start()
+		slave.Close() // aider holds its own copy; we must not keep the pty open
+		if err != nil {
+			logError(fmt.Sprintf("Failed to start aider: %v", err))
+			return agentResult{Err: err}
+		}
+	} else {
+		pipe, err := cmd.StdoutPipe()
+		if err != nil {
+			logError(fmt.Sprintf("Failed to create stdout pipe: %v", err))
+			return agentResult{Err: err}
+		}
+		stdout = pipe
+
+		cmd.Stderr = cmd.Stdout // Combine stderr with stdout
+
+		if err := cmd.Start(); err != nil {
+			logError(fmt.Sprintf("Failed to start aider: %v", err))
+			return agentResult{Err: err}
+		}
+	}
+
+	// Nobody can answer an interactive prompt: stop aider rather than hang
+	// until the timeout.
+	var mu sync.Mutex
+	var prompt, promptKind string
+	detectPrompts := config.StdinMode != stdinInherit
+	prompts := &promptWatcher{settle: promptSettleTime, onPrompt: func(line, kind string) {
+		mu.Lock()
+		defer mu.Unlock()
+		if prompt == "" {
+			prompt, promptKind = strings.TrimSpace(line), kind
+			cancel()
+		}
+	}}
+
+	// Once a status has been reported, aider only has edits, lint and commit
+	// steps left; with --early-stop it gets a grace period for those and is
+	// then interrupted (and killed if it ignores the interrupt).
+	var grace *time.Timer
+	var stopped bool
+	exited := make(chan struct{})
+	detector := &streamDetector{}
+	if config.EarlyStop {
+		detector.onStatus = func(status, reason string) {
+			mu.Lock()
+			defer mu.Unlock()
+			if grace != nil || prompt != "" {
+				return
+			}
+			if config.Verbose {
+				logInfo(fmt.Sprintf("Status %s seen; aider has %ds to finish", status, config.EarlyStopGrace))
+			}
+			grace = time.AfterFunc(time.Duration(config.EarlyStopGrace)*time.Second, func() {
+				mu.Lock()
+				stopped = true
+				mu.Unlock()
+				stopAgent(cmd, exited)
+			})
+		}
+	}
+
+	var outputBuilder strings.Builder
+
+	onLine := func(raw string) {
+		prompts.line()
+
+		// Completion/notes detection and the log only ever see plain text
+		line := cleanTerminalLine(raw)
+		outputBuilder.WriteString(line)
+		outputBuilder.WriteString("\n")
+		detector.feed(line)
+		hub.publish("output", line)
+
+		if logWriter != nil {
+			fmt.Fprintln(logWriter, line)
+		}
+	}
+
+	var onPartial func(string)
+	if detectPrompts {
+		onPartial = func(partial string) { prompts.partial(cleanTerminalLine(partial)) }
+	}
+
+	// The HTTP API (--serve) can stop the loop mid-iteration
+	control.setAgentStopper(func() { stopAgent(cmd, exited) })
+	defer control.setAgentStopper(nil)
+
+	readErr := streamLines(stdout, os.Stdout, onLine, onPartial)
+	prompts.line()
+	if readErr != nil {
+		logWarn(fmt.Sprintf("Error reading aider output: %v", readErr))
+	}
+
+	_ = cmd.Wait()
+	close(exited)
+
+	mu.Lock()
+	defer mu.Unlock()
+	termination := ""
+	switch {
+	case stopped:
+		termination = terminationStopped
+	case grace != nil:
+		grace.Stop()
+		termination = terminationExited
+	case detector.Status != "":
+		termination = terminationNatural
+	}
+
+	return agentResult{
+		Output:       outputBuilder.String(),
+		ExitCode:     cmd.ProcessState.ExitCode(),
+		TimedOut:     ctx.Err() == context.DeadlineExceeded,
+		Prompt:       prompt,
+		PromptKind:   promptKind,
+		ReadErr:      readErr,
+		Status:       detector.Status,
+		StatusReason: detector.StatusReason,
+		Termination:  termination,
+	}
+}
+
+// stopAgent interrupts aider, as Ctrl-C would, and kills it if it has not
+// exited within earlyStopKillDelay. Where interrupts are not supported
+// (Windows) it is killed straight away.
+func stopAgent(cmd *exec.Cmd, exited <-chan struct{}) {
+	if err := cmd.Process.Signal(os.Interrupt); err != nil {
+		_ = cmd.Process.Kill()
+		return
+	}
+	select {
+	case <-exited:
+	case <-time.After(earlyStopKillDelay):
+		_ = cmd.Process.Kill()
+	}
+}
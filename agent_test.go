@@ -0,0 +1,100 @@
+package main
+
+import (
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDetectInteractivePrompt(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		// Prompts aider leaves waiting for an answer
+		{"Add src/main.go to the chat? (Y)es/(N)o/(A)ll/(S)kip all/(D)on't ask again [Yes]: ", "confirmation"},
+		{"Add file to the chat? (Y)es/(N)o [Yes]:", "confirmation"},
+		{"Create new file? (Y)es/(N)o [Yes]: ", "confirmation"},
+		{"Run shell command? (Y)es/(N)o/(D)on't ask again [Yes]: ", "confirmation"},
+		{"Open documentation url for more info? (Y)es/(N)o/(D)on't ask again [Yes]: ", "confirmation"},
+		{"Overwrite existing file? [y/N] ", "confirmation"},
+		{"Proceed? [Y/n]: ", "confirmation"},
+		{"Enter your OpenAI API key: ", "credentials"},
+		{"Paste your Anthropic API key:", "credentials"},
+		{"Enter the access token: ", "credentials"},
+		{"Press Enter to continue...", "press_enter"},
+		{"press enter to open the browser:", "press_enter"},
+		{"Login to OpenRouter or create a free account? ", "login"},
+
+		// Ordinary output that happens to look a bit like a question
+		{"What does this function do?", ""},
+		{"Should we add a cache?", ""},
+		{"Add file to the chat?", ""},
+		{"Create new file? (Y)es/(N)o [Yes]: y", ""},
+		{"	if ok, err := confirm(\"(Y)es/(N)o [Yes]: \"); err != nil {", ""},
+		{"    prompt := \"Enter your API key: \"", ""},
+		{"print(input(\"Continue? [y/N] \"))", ""},
+		{"Enter the loop when ready", ""},
+		{"The token: is parsed by the lexer.", ""},
+		{"Press enter to continue. Then run make.", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := detectInteractivePrompt(tt.line); got != tt.want {
+			t.Errorf("detectInteractivePrompt(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestPromptWatcherOnlyChecksTheUnterminatedTail(t *testing.T) {
+	const prompt = "Add file to the chat? (Y)es/(N)o [Yes]: "
+	tests := []struct {
+		name   string
+		output string
+		chunk  int
+		want   string // kind flagged, "" for none
+	}{
+		{name: "prompt left waiting", output: "Thinking...\n" + prompt, chunk: 1024, want: "confirmation"},
+		{name: "prompt arriving in pieces", output: "Thinking...\n" + prompt, chunk: 5, want: "confirmation"},
+		{name: "prompt answered by --yes", output: prompt + "y\nApplied edit to a.go\n", chunk: 1024},
+		{name: "prompt text as a complete line", output: "Added docs:\n" + prompt + "\n", chunk: 1024},
+		{name: "answer on the same line in a later read", output: prompt + "y\n", chunk: len(prompt)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var got []string
+			w := &promptWatcher{settle: 20 * time.Millisecond, onPrompt: func(line, kind string) {
+				mu.Lock()
+				defer mu.Unlock()
+				got = append(got, kind)
+			}}
+			// aider keeps the pipe open while it waits for an answer
+			r, pw := io.Pipe()
+			done := make(chan error)
+			go func() { done <- streamLines(r, nil, func(string) { w.line() }, w.partial) }()
+			for rest := tt.output; rest != ""; {
+				n := min(tt.chunk, len(rest))
+				pw.Write([]byte(rest[:n]))
+				rest = rest[n:]
+			}
+			time.Sleep(100 * time.Millisecond)
+			pw.Close()
+			if err := <-done; err != nil {
+				t.Fatal(err)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			want := []string{}
+			if tt.want != "" {
+				want = []string{tt.want}
+			}
+			if strings.Join(got, ",") != strings.Join(want, ",") {
+				t.Errorf("flagged %q, want %q", got, want)
+			}
+		})
+	}
+}
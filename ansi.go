@@ -0,0 +1,30 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// ansiRe matches CSI sequences (colors, cursor movement), OSC sequences
+// (titles, hyperlinks) and two-byte escapes.
+var ansiRe = regexp.MustCompile(`\x1b\[[0-?]*[ -/]*[@-~]|\x1b\][^\x07\x1b]*(?:\x07|\x1b\\)|\x1b[@-Z\\-_]`)
+
+// stripANSI removes terminal escape sequences from s.
+func stripANSI(s string) string {
+	if !strings.Contains(s, "\x1b") {
+		return s
+	}
+	return ansiRe.ReplaceAllString(s, "")
+}
+
+// cleanTerminalLine turns a raw line of terminal output into plain text:
+// escape sequences are removed and carriage returns are applied the way a
+// terminal would, keeping only what was drawn last (e.g. the final state of
+// a progress spinner).
+func cleanTerminalLine(line string) string {
+	line = strings.TrimRight(stripANSI(line), "\r")
+	if i := strings.LastIndex(line, "\r"); i >= 0 {
+		line = line[i+1:]
+	}
+	return line
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// Approval gate decisions.
+const (
+	approveAccept = "accept"
+	approveReject = "reject"
+	approveStop   = "stop"
+)
+
+// terminal is the controlling terminal used by the approval gate. It is
+// opened once so buffered input is not lost between iterations.
+var terminal struct {
+	in     io.Reader
+	out    io.Writer
+	reader *bufio.Reader
+}
+
+// openTerminal opens the controlling terminal so the approval gate works even
+// when stdin is redirected. It falls back to stdin/stdout.
+func openTerminal() {
+	if terminal.reader != nil {
+		return
+	}
+	terminal.in, terminal.out = os.Stdin, os.Stdout
+	in, out := "/dev/tty", "/dev/tty"
+	if runtime.GOOS == "windows" {
+		in, out = "CONIN$", "CONOUT$"
+	}
+	if r, err := os.Open(in); err == nil {
+		if w, err := os.OpenFile(out, os.O_WRONLY, 0); err == nil {
+			terminal.in, terminal.out = r, w
+		} else {
+			r.Close()
+		}
+	}
+	terminal.reader = bufio.NewReader(terminal.in)
+}
+
+// editNotes opens the notes file in $VISUAL / $EDITOR on the terminal.
+func editNotes(in io.Reader, out io.Writer) error {
+	if config.NotesFile == "" {
+		return fmt.Errorf("no notes file configured (use --notes-file)")
+	}
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+		if runtime.GOOS == "windows" {
+			editor = "notepad"
+		}
+	}
+	fields := strings.Fields(editor)
+	cmd := exec.Command(fields[0], append(fields[1:], config.NotesFile)...)
+	cmd.Stdin = in
+	cmd.Stdout = out
+	cmd.Stderr = out
+	return cmd.Run()
+}
+
+// approvalGate shows what the iteration changed and asks the human on the
+// controlling terminal whether to accept it, reject it (reverting to snap),
+// edit the notes, or stop the loop.
+func approvalGate(rec iterationRecord, snap *workspaceSnapshot) string {
+	openTerminal()
+	in, out, reader := terminal.in, terminal.out, terminal.reader
+
+	fmt.Fprintln(out)
+	fmt.Fprintf(out, "%s─── Approval required: iteration %d ───%s\n", colorBold, rec.Iteration, colorReset)
+	fmt.Fprintf(out, "%sChanges:%s\n%s", colorCyan, colorReset, snap.diffStat())
+	if current, _ := getNotes(); config.NotesFile != "" && current != string(snap.files[config.NotesFile]) {
+		fmt.Fprintf(out, "%sNotes:%s\n%s\n", colorCyan, colorReset, lastNotesEntry())
+	} else {
+		fmt.Fprintf(out, "%sNotes:%s (none this iteration)\n", colorCyan, colorReset)
+	}
+	status := rec.Status
+	if status == "" {
+		status = "(none)"
+	}
+	fmt.Fprintf(out, "%sStatus:%s %s (outcome: %s)\n", colorCyan, colorReset, status, rec.Outcome)
+	if rec.StatusReason != "" {
+		fmt.Fprintf(out, "%sReason:%s %s\n", colorCyan, colorReset, rec.StatusReason)
+	}
+
+	for {
+		fmt.Fprintf(out, "\n%s[a]ccept, [r]eject (revert changes), [e]dit notes, [d]iff, [s]top? %s", colorYellow, colorReset)
+		line, err := reader.ReadString('\n')
+		if err != nil && line == "" {
+			// No terminal to ask: fail safe by stopping
+			fmt.Fprintln(out)
+			logError("No terminal available for the approval gate; stopping")
+			return approveStop
+		}
+
+		switch strings.ToLower(strings.TrimSpace(line)) {
+		case "a", "accept":
+			return approveAccept
+		case "r", "reject":
+			if err := snap.restore(); err != nil {
+				logError(fmt.Sprintf("Failed to revert iteration %d: %v", rec.Iteration, err))
+				continue
+			}
+			logWarn(fmt.Sprintf("Iteration %d rejected; changes reverted", rec.Iteration))
+			return approveReject
+		case "e", "edit", "edit-notes":
+			if err := editNotes(in, out); err != nil {
+				logWarn(fmt.Sprintf("Failed to edit notes: %v", err))
+			}
+		case "d", "diff":
+			diff, err := gitOutput("diff", snap.base())
+			if err != nil {
+				logWarn(err.Error())
+			} else {
+				fmt.Fprintln(out, diff)
+			}
+		case "s", "stop":
+			return approveStop
+		}
+	}
+}
+
+// lastNotesEntry returns the most recent section of the notes file.
+func lastNotesEntry() string {
+	notes, err := getNotes()
+	if err != nil || notes == "" {
+		return ""
+	}
+	_, entries := splitNotesEntries(notes)
+	if len(entries) == 0 {
+		return ""
+	}
+	return strings.TrimSpace(entries[len(entries)-1].String())
+}
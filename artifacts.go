@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Files kept for each iteration under .ralph/sessions/<id>/iterations/NNN.
+const (
+	artifactPrompt   = "prompt.md"
+	artifactOutput   = "output.txt"
+	artifactNotes    = "notes.md"
+	artifactDiff     = "diff.patch"
+	artifactVerify   = "verify.txt"
+	artifactHooks    = "hooks.txt"
+	artifactCoverage = "coverage.txt"
+)
+
+// Event types written to .ralph/sessions/<id>/events.jsonl.
+const (
+	eventSessionStarted   = "session_started"
+	eventIterationStarted = "iteration_started"
+	eventIterationEnded   = "iteration_finished"
+	eventStatus           = "status"
+	eventVerify           = "verify"
+	eventCoverage         = "coverage"
+	eventRequirementDone  = "requirement_completed"
+	eventSessionEnded     = "session_finished"
+)
+
+// sessionEvent is one line of a session's events log.
+type sessionEvent struct {
+	Time      time.Time `json:"time"`
+	Type      string    `json:"type"`
+	Iteration int       `json:"iteration,omitempty"`
+	Outcome   string    `json:"outcome,omitempty"`
+	Status    string    `json:"status,omitempty"`
+	Message   string    `json:"message,omitempty"`
+}
+
+// eventsMu serialises writes to the events log.
+var eventsMu sync.Mutex
+
+// iterationDir is where the artifacts of iteration n are kept.
+func (s *sessionState) iterationDir(n int) string {
+	return filepath.Join(s.dir(), "iterations", fmt.Sprintf("%03d", n))
+}
+
+// saveArtifact stores one artifact of iteration n. Failures are logged and
+// otherwise ignored: artifacts are for review, not for the loop itself.
+func (s *sessionState) saveArtifact(n int, name, content string) {
+	if s == nil || config.DryRun || content == "" {
+		return
+	}
+	dir := s.iterationDir(n)
+	err := os.MkdirAll(dir, 0755)
+	if err == nil {
+		err = os.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+	}
+	if err != nil {
+		logWarn(fmt.Sprintf("Failed to save iteration artifact %s: %v", name, err))
+	}
+}
+
+// loadArtifact returns an artifact of iteration n, or "" if there is none.
+func (s *sessionState) loadArtifact(n int, name string) string {
+	data, err := os.ReadFile(filepath.Join(s.iterationDir(n), name))
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// emit appends an event to the session's events log.
+func (s *sessionState) emit(ev sessionEvent) {
+	if s == nil {
+		return
+	}
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	publishEvent(ev)
+	if config.DryRun {
+		return
+	}
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return
+	}
+
+	eventsMu.Lock()
+	defer eventsMu.Unlock()
+	if err := os.MkdirAll(s.dir(), 0755); err != nil {
+		return
+	}
+	f, err := os.OpenFile(filepath.Join(s.dir(), "events.jsonl"), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		logWarn(fmt.Sprintf("Failed to write event: %v", err))
+		return
+	}
+	defer f.Close()
+	f.Write(append(data, '\n'))
+}
+
+// loadEvents reads a session's events log, oldest first.
+func (s *sessionState) loadEvents() []sessionEvent {
+	f, err := os.Open(filepath.Join(s.dir(), "events.jsonl"))
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var events []sessionEvent
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for sc.Scan() {
+		var ev sessionEvent
+		if json.Unmarshal(sc.Bytes(), &ev) == nil {
+			events = append(events, ev)
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Time.Before(events[j].Time) })
+	return events
+}
+
+// iterationDiff is what changed in the work tree since snap was taken:
+// the diff (commits included) plus the files created but left untracked.
+func iterationDiff(snap *workspaceSnapshot) string {
+	if snap == nil {
+		return ""
+	}
+	defer startSpan("git diff").end()
+
+	var b strings.Builder
+	diff, err := gitOutput("diff", snap.base())
+	if err != nil {
+		return fmt.Sprintf("(git diff failed: %v)\n", err)
+	}
+	if diff != "" {
+		b.WriteString(diff + "\n")
+	}
+	if now, err := gitUntracked(); err == nil {
+		var added []string
+		for path := range now {
+			if !snap.Untracked[path] && !strings.HasPrefix(filepath.ToSlash(path), ralphDir+"/") {
+				added = append(added, path)
+			}
+		}
+		sort.Strings(added)
+		for _, path := range added {
+			fmt.Fprintf(&b, "# new untracked file: %s\n", path)
+		}
+	}
+	return b.String()
+}
+
+// aiderModelRe matches the model aider announces at startup, e.g.
+// "Main model: anthropic/claude-sonnet-4 with diff edit format".
+var aiderModelRe = regexp.MustCompile(`(?m)^(?:Main model|Model): (\S+)`)
+
+// iterationModel is the model an iteration ran with: as announced by
+// aider, else as passed in the aider options.
+func iterationModel(output string) string {
+	if m := aiderModelRe.FindStringSubmatch(output); m != nil {
+		return m[1]
+	}
+	for i, opt := range config.AiderOpts {
+		if opt == "--model" && i+1 < len(config.AiderOpts) {
+			return config.AiderOpts[i+1]
+		}
+		if strings.HasPrefix(opt, "--model=") {
+			return opt[len("--model="):]
+		}
+	}
+	return ""
+}
+
+// verifyArtifact is the full output of an iteration's verification
+// commands, which the session state leaves out.
+func verifyArtifact(results []verifyResult) string {
+	var b strings.Builder
+	for _, r := range results {
+		fmt.Fprintf(&b, "$ %s\n", r.Command)
+		b.WriteString(r.Output)
+		if r.Output != "" && !strings.HasSuffix(r.Output, "\n") {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "(exit code %d)\n\n", r.ExitCode)
+	}
+	return b.String()
+}
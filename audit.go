@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// runAudit runs a completion audit: a reviewer pass (with aider in
+// --dry-run so nothing is edited) that must itself emit the completion tag
+// for the loop to stop. Any gaps it lists are appended to the notes.
+func runAudit(iteration int, logWriter io.Writer) (rec iterationRecord) {
+	rec = iterationRecord{Iteration: iteration, Kind: "audit", StartedAt: time.Now()}
+	defer func() {
+		rec.EndedAt = time.Now()
+		rec.DurationSeconds = rec.EndedAt.Sub(rec.StartedAt).Seconds()
+	}()
+
+	logIter(fmt.Sprintf("Completion claimed; auditing every SPECS requirement (iteration %d)...", iteration))
+	session.emit(sessionEvent{Type: eventIterationStarted, Iteration: iteration, Message: "completion audit"})
+
+	promptSpan := startSpan("prompt")
+	prompt, err := buildPrompt(strings.TrimSpace(embeddedAuditPrompt))
+	promptSpan.set("ralph.prompt_bytes", len(prompt))
+	promptSpan.end()
+	if err != nil {
+		logError(fmt.Sprintf("Failed to build audit prompt: %v", err))
+		rec.Outcome = "error"
+		return rec
+	}
+	session.saveArtifact(iteration, artifactPrompt, prompt)
+
+	args := []string{"--message", prompt, "--yes", "--dry-run"}
+	if config.ConventionsFile != "" && config.ConventionsMode == "read" {
+		args = append(args, "--read", config.ConventionsFile)
+	}
+	args = append(args, config.AiderOpts...)
+
+	if config.DryRun {
+		logInfo("[DRY RUN] Would run completion audit with aider --dry-run")
+		rec.Outcome = "dry_run"
+		return rec
+	}
+
+	result := runAgent(args, logWriter)
+	if result.Err != nil {
+		rec.Outcome = "error"
+		return rec
+	}
+	rec.AgentExitCode = &result.ExitCode
+	session.saveArtifact(iteration, artifactOutput, result.Output)
+	rec.Model = iterationModel(result.Output)
+	rec.TokensSent, rec.TokensReceived, rec.Cost = parseAiderUsage(result.Output)
+	rec.Termination = result.Termination
+	if result.ReadErr != nil {
+		rec.ReadError = result.ReadErr.Error()
+	}
+	if result.TimedOut {
+		logWarn(fmt.Sprintf("Completion audit timed out after %ds - aider was killed", config.Timeout))
+		rec.Outcome = "timeout"
+		return rec
+	}
+	if result.Prompt != "" {
+		logError(fmt.Sprintf("aider asked an interactive question (%s) during the audit and was stopped: %q", result.PromptKind, result.Prompt))
+		rec.Outcome = "interactive_prompt"
+		return rec
+	}
+
+	if logWriter != nil {
+		fmt.Fprintf(logWriter, "\n=== End of Iteration %d (completion audit) ===\n\n", iteration)
+	}
+
+	rec.Status, rec.StatusReason = result.status()
+
+	if rec.Status == statusCompleted {
+		logOK("Completion audit confirmed every requirement is met")
+		rec.Outcome = "audit_confirmed"
+		return rec
+	}
+
+	rec.Outcome = "audit_rejected"
+	gaps := extractRalphNotes(result.Output)
+	if gaps == "" {
+		gaps = "The completion audit did not confirm completion and listed no specific gaps. Re-check every SPECS requirement against the code."
+	}
+	logWarn("Completion audit found gaps; continuing the loop")
+	if err := appendNotesEntry(fmt.Sprintf("Iteration %d (completion audit: gaps found)", iteration), gaps); err != nil {
+		logWarn(fmt.Sprintf("Failed to append audit gaps to notes: %v", err))
+	}
+	if err := updateStructuredNotes(iteration, gaps); err != nil {
+		logWarn(fmt.Sprintf("Failed to update structured notes: %v", err))
+	}
+	return rec
+}
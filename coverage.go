@@ -0,0 +1,406 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Coverage report formats.
+const (
+	coverageAuto      = "auto"
+	coverageGo        = "go" // go test -coverprofile
+	coverageCobertura = "cobertura"
+	coverageLCOV      = "lcov"
+)
+
+// What a coverage or test-count regression does to the iteration.
+const (
+	coverageActionFail   = "fail"   // void its status and tell the next iteration
+	coverageActionRevert = "revert" // undo its changes
+)
+
+// coverageEpsilon absorbs rounding when comparing coverage percentages.
+const coverageEpsilon = 0.01
+
+// coverageMeasurement is one run of the coverage command. Fields are nil
+// when the value could not be determined.
+type coverageMeasurement struct {
+	Percent     *float64 `json:"percent,omitempty"`
+	TestsPassed *int     `json:"tests_passed,omitempty"`
+	TestsFailed *int     `json:"tests_failed,omitempty"`
+}
+
+func (m coverageMeasurement) String() string {
+	var parts []string
+	if m.Percent != nil {
+		parts = append(parts, fmt.Sprintf("coverage %.1f%%", *m.Percent))
+	}
+	if m.TestsPassed != nil {
+		parts = append(parts, fmt.Sprintf("%d tests passed", *m.TestsPassed))
+	}
+	if m.TestsFailed != nil && *m.TestsFailed > 0 {
+		parts = append(parts, fmt.Sprintf("%d failed", *m.TestsFailed))
+	}
+	if len(parts) == 0 {
+		return "no coverage or test counts found"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// coverageReference is what each iteration is compared with: the baseline
+// measured before the first iteration, then the last accepted iteration.
+var coverageReference coverageMeasurement
+
+// measureCoverage runs --coverage-cmd, then reads the total coverage from
+// --coverage-file and the test counts from the command's output.
+func measureCoverage(logWriter io.Writer) (coverageMeasurement, verifyResult) {
+	coverageSpan := startSpan("coverage")
+	defer coverageSpan.end()
+
+	start := time.Now()
+	r := runShellCommand(config.CoverageCmd, nil)
+	if logWriter != nil {
+		fmt.Fprintf(logWriter, "=== Coverage: %s (exit %d) ===\n%s\n", config.CoverageCmd, r.ExitCode, r.Output)
+	}
+
+	var m coverageMeasurement
+	if passed, failed, ok := parseTestCounts(r.Output); ok {
+		m.TestsPassed, m.TestsFailed = &passed, &failed
+	}
+	if info, err := os.Stat(config.CoverageFile); err != nil {
+		logWarn(fmt.Sprintf("Coverage file not found after %q: %v", config.CoverageCmd, err))
+	} else if info.ModTime().Before(start.Add(-time.Second)) {
+		logWarn(fmt.Sprintf("Coverage file %s was not updated by %q; ignoring it", config.CoverageFile, config.CoverageCmd))
+	} else if percent, err := parseCoverageFile(config.CoverageFile, config.CoverageFormat); err != nil {
+		logWarn(fmt.Sprintf("Failed to read coverage from %s: %v", config.CoverageFile, err))
+	} else {
+		m.Percent = &percent
+	}
+
+	if m.Percent != nil {
+		coverageSpan.set("ralph.coverage.percent", *m.Percent)
+	}
+	if m.TestsPassed != nil {
+		coverageSpan.set("ralph.tests.passed", *m.TestsPassed)
+	}
+	return m, r
+}
+
+// coverageCommandFailure describes a failed run of --coverage-cmd.
+func coverageCommandFailure(r verifyResult) string {
+	if r.TimedOut {
+		return fmt.Sprintf("the coverage command timed out after %ds", config.Timeout)
+	}
+	return fmt.Sprintf("the coverage command failed (exit %d)", r.ExitCode)
+}
+
+// startCoverageGuard measures the baseline the first iteration is compared
+// with.
+func startCoverageGuard(logWriter io.Writer) {
+	if config.CoverageCmd == "" || config.DryRun {
+		return
+	}
+	logInfo(fmt.Sprintf("Measuring baseline coverage: %s", config.CoverageCmd))
+	m, r := measureCoverage(logWriter)
+	coverageReference = m
+	logInfo(fmt.Sprintf("Baseline: %s", m))
+	if !r.Passed {
+		logWarn(fmt.Sprintf("Baseline: %s; iterations fail the guard until it passes", coverageCommandFailure(r)))
+	}
+	if m.Percent != nil && config.CoverageMin > 0 && *m.Percent < config.CoverageMin-coverageEpsilon {
+		logWarn(fmt.Sprintf("Baseline coverage %.1f%% is below --coverage-min %g%%; iterations fail the guard until it is reached", *m.Percent, config.CoverageMin))
+	}
+
+	session.mu.Lock()
+	session.CoverageBaseline = &m
+	if err := session.save(); err != nil {
+		logWarn(fmt.Sprintf("Failed to save session state: %v", err))
+	}
+	session.mu.Unlock()
+}
+
+// coverageProblems lists how m falls short of the thresholds and of ref. A
+// value ref has but m lacks is a problem too: a build that no longer
+// compiles leaves nothing to measure.
+func coverageProblems(m, ref coverageMeasurement) []string {
+	var problems []string
+	if m.Percent == nil && ref.Percent != nil {
+		problems = append(problems, fmt.Sprintf("coverage could no longer be measured (was %.1f%%)", *ref.Percent))
+	}
+	if m.TestsPassed == nil && ref.TestsPassed != nil {
+		problems = append(problems, fmt.Sprintf("tests could no longer be counted (%d passed before)", *ref.TestsPassed))
+	}
+	if m.Percent != nil {
+		p := *m.Percent
+		if config.CoverageMin > 0 && p < config.CoverageMin-coverageEpsilon {
+			problems = append(problems, fmt.Sprintf("coverage %.1f%% is below the %g%% minimum", p, config.CoverageMin))
+		}
+		if ref.Percent != nil && p < *ref.Percent-coverageEpsilon {
+			problems = append(problems, fmt.Sprintf("coverage fell from %.1f%% to %.1f%%", *ref.Percent, p))
+		}
+	}
+	if m.TestsPassed != nil {
+		n := *m.TestsPassed
+		if config.CoverageMinTests > 0 && n < config.CoverageMinTests {
+			problems = append(problems, fmt.Sprintf("%d passing tests is below the minimum of %d", n, config.CoverageMinTests))
+		}
+		if ref.TestsPassed != nil && n < *ref.TestsPassed {
+			problems = append(problems, fmt.Sprintf("passing tests fell from %d to %d", *ref.TestsPassed, n))
+		}
+	}
+	if m.TestsFailed != nil && ref.TestsFailed != nil && *m.TestsFailed > *ref.TestsFailed {
+		problems = append(problems, fmt.Sprintf("failing tests rose from %d to %d", *ref.TestsFailed, *m.TestsFailed))
+	}
+	return problems
+}
+
+// guardCoverage measures coverage after rec's iteration and applies
+// --coverage-action if it regressed. snap is the work tree before the
+// iteration, for reverting.
+func guardCoverage(rec *iterationRecord, snap *workspaceSnapshot, logWriter io.Writer) {
+	m, r := measureCoverage(logWriter)
+	rec.Coverage = &m
+	session.saveArtifact(rec.Iteration, artifactCoverage, verifyArtifact([]verifyResult{r}))
+
+	problems := coverageProblems(m, coverageReference)
+	if !r.Passed {
+		problems = append([]string{coverageCommandFailure(r)}, problems...)
+	}
+	if len(problems) == 0 {
+		logOK(fmt.Sprintf("Coverage guard passed: %s", m))
+		session.emit(sessionEvent{Type: eventCoverage, Iteration: rec.Iteration, Outcome: "passed", Message: m.String()})
+		if m.Percent != nil {
+			coverageReference.Percent = m.Percent
+		}
+		if m.TestsPassed != nil {
+			coverageReference.TestsPassed, coverageReference.TestsFailed = m.TestsPassed, m.TestsFailed
+		}
+		return
+	}
+
+	summary := strings.Join(problems, "; ")
+	logError(fmt.Sprintf("Coverage guard failed: %s", summary))
+	session.emit(sessionEvent{Type: eventCoverage, Iteration: rec.Iteration, Outcome: "failed", Message: summary})
+	if rec.Status != "" {
+		logWarn(fmt.Sprintf("Ignoring the reported %s status: the coverage guard failed", rec.Status))
+	}
+	rec.Status, rec.StatusReason = "", summary
+	rec.Outcome = "coverage_failed"
+
+	title := fmt.Sprintf("Iteration %d (coverage guard failed)", rec.Iteration)
+	if config.CoverageAction == coverageActionRevert {
+		if snap == nil {
+			logError("Cannot revert the iteration: no snapshot of the work tree")
+		} else if err := snap.restore(); err != nil {
+			logError(fmt.Sprintf("Failed to revert iteration %d: %v", rec.Iteration, err))
+		} else {
+			// session.record works out the checked requirements from the
+			// restored specs, so reverted checkboxes don't count as done
+			logWarn(fmt.Sprintf("Iteration %d reverted", rec.Iteration))
+			rec.Outcome = "coverage_reverted"
+			title = fmt.Sprintf("Iteration %d (reverted by the coverage guard)", rec.Iteration)
+		}
+	}
+
+	var notes strings.Builder
+	for _, p := range problems {
+		fmt.Fprintf(&notes, "- %s\n", p)
+	}
+	if rec.Outcome == "coverage_reverted" {
+		notes.WriteString("- Its changes were reverted; redo the work without losing tests or coverage\n")
+	} else {
+		notes.WriteString("- Restore the lost tests/coverage before anything else\n")
+	}
+	if err := appendNotesEntry(title, notes.String()); err != nil {
+		logWarn(fmt.Sprintf("Failed to append notes: %v", err))
+	}
+}
+
+// parseCoverageFile returns the total line coverage, in percent, of a
+// coverage report.
+func parseCoverageFile(path, format string) (float64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	if format == coverageAuto {
+		format = detectCoverageFormat(string(data))
+	}
+	switch format {
+	case coverageGo:
+		return parseGoCoverProfile(string(data))
+	case coverageCobertura:
+		return parseCobertura(data)
+	case coverageLCOV:
+		return parseLCOV(string(data))
+	}
+	return 0, fmt.Errorf("unrecognised coverage format (use --coverage-format go, cobertura or lcov)")
+}
+
+func detectCoverageFormat(content string) string {
+	trimmed := strings.TrimSpace(content)
+	switch {
+	case strings.HasPrefix(trimmed, "mode:"):
+		return coverageGo
+	case strings.HasPrefix(trimmed, "<"):
+		return coverageCobertura
+	case strings.Contains(content, "end_of_record") || strings.HasPrefix(trimmed, "TN:") || strings.HasPrefix(trimmed, "SF:"):
+		return coverageLCOV
+	}
+	return ""
+}
+
+// parseGoCoverProfile computes statement coverage from a Go coverprofile.
+// Blocks listed more than once (e.g. with -coverpkg) count once, covered if
+// any run covered them.
+func parseGoCoverProfile(content string) (float64, error) {
+	type block struct{ statements, count int }
+	blocks := map[string]block{}
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	scanner.Buffer(make([]byte, 1024*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "mode:") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			return 0, fmt.Errorf("malformed coverprofile line %q", line)
+		}
+		statements, err1 := strconv.Atoi(fields[1])
+		count, err2 := strconv.Atoi(fields[2])
+		if err1 != nil || err2 != nil {
+			return 0, fmt.Errorf("malformed coverprofile line %q", line)
+		}
+		b := blocks[fields[0]]
+		b.statements = statements
+		if count > b.count {
+			b.count = count
+		}
+		blocks[fields[0]] = b
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	total, covered := 0, 0
+	for _, b := range blocks {
+		total += b.statements
+		if b.count > 0 {
+			covered += b.statements
+		}
+	}
+	if total == 0 {
+		return 0, fmt.Errorf("no statements in coverprofile")
+	}
+	return 100 * float64(covered) / float64(total), nil
+}
+
+// parseCobertura reads the total line rate of a Cobertura XML report.
+func parseCobertura(data []byte) (float64, error) {
+	var report struct {
+		XMLName      xml.Name `xml:"coverage"`
+		LineRate     string   `xml:"line-rate,attr"`
+		LinesCovered string   `xml:"lines-covered,attr"`
+		LinesValid   string   `xml:"lines-valid,attr"`
+	}
+	if err := xml.Unmarshal(data, &report); err != nil {
+		return 0, err
+	}
+	covered, err1 := strconv.Atoi(report.LinesCovered)
+	valid, err2 := strconv.Atoi(report.LinesValid)
+	if err1 == nil && err2 == nil && valid > 0 {
+		return 100 * float64(covered) / float64(valid), nil
+	}
+	rate, err := strconv.ParseFloat(report.LineRate, 64)
+	if err != nil {
+		return 0, fmt.Errorf("no line-rate in Cobertura report")
+	}
+	return 100 * rate, nil
+}
+
+// parseLCOV sums the lines found (LF) and hit (LH) of every LCOV record.
+func parseLCOV(content string) (float64, error) {
+	found, hit := 0, 0
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if v, ok := strings.CutPrefix(line, "LF:"); ok {
+			n, _ := strconv.Atoi(v)
+			found += n
+		} else if v, ok := strings.CutPrefix(line, "LH:"); ok {
+			n, _ := strconv.Atoi(v)
+			hit += n
+		}
+	}
+	if found == 0 {
+		return 0, fmt.Errorf("no LF/LH lines in LCOV report")
+	}
+	return 100 * float64(hit) / float64(found), nil
+}
+
+var (
+	goTestResultRe = regexp.MustCompile(`(?m)^\s*--- (PASS|FAIL): `)
+	testsPassedRe  = regexp.MustCompile(`(\d+) passed`)
+	testsFailedRe  = regexp.MustCompile(`(\d+) failed`)
+)
+
+// parseTestCounts counts passing and failing tests in test runner output:
+// go test -json or -v, or a summary line such as pytest's "3 failed, 97
+// passed" or Jest's "Tests: 97 passed, 100 total".
+func parseTestCounts(output string) (passed, failed int, ok bool) {
+	lines := strings.Split(output, "\n")
+
+	// go test -json: one event per line; only test (not package) results count
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "{") {
+			continue
+		}
+		var event struct{ Action, Test string }
+		if json.Unmarshal([]byte(line), &event) != nil || event.Test == "" {
+			continue
+		}
+		switch event.Action {
+		case "pass":
+			passed++
+			ok = true
+		case "fail":
+			failed++
+			ok = true
+		}
+	}
+	if ok {
+		return passed, failed, true
+	}
+
+	if matches := goTestResultRe.FindAllStringSubmatch(output, -1); len(matches) > 0 {
+		for _, m := range matches {
+			if m[1] == "PASS" {
+				passed++
+			} else {
+				failed++
+			}
+		}
+		return passed, failed, true
+	}
+
+	for i := len(lines) - 1; i >= 0; i-- {
+		m := testsPassedRe.FindStringSubmatch(lines[i])
+		if m == nil {
+			continue
+		}
+		passed, _ = strconv.Atoi(m[1])
+		if f := testsFailedRe.FindStringSubmatch(lines[i]); f != nil {
+			failed, _ = strconv.Atoi(f[1])
+		}
+		return passed, failed, true
+	}
+	return 0, 0, false
+}
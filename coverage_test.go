@@ -0,0 +1,296 @@
+package main
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseGoCoverProfile(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile string
+		want    float64
+		wantErr bool
+	}{
+		{
+			name: "simple",
+			profile: `mode: set
+a.go:1.1,2.2 3 1
+a.go:3.1,4.2 1 0
+`,
+			want: 75,
+		},
+		{
+			// With -coverpkg every test binary lists every block; a block
+			// counts once, covered if any binary covered it.
+			name: "duplicate blocks from -coverpkg",
+			profile: `mode: atomic
+a.go:1.1,2.2 2 0
+a.go:3.1,4.2 2 0
+a.go:1.1,2.2 2 5
+a.go:3.1,4.2 2 0
+`,
+			want: 50,
+		},
+		{
+			name: "repeated mode lines from concatenated profiles",
+			profile: `mode: count
+a.go:1.1,2.2 1 1
+mode: count
+b.go:1.1,2.2 1 0
+`,
+			want: 50,
+		},
+		{name: "no statements", profile: "mode: set\n", wantErr: true},
+		{name: "malformed line", profile: "mode: set\na.go:1.1,2.2 x 1\n", wantErr: true},
+		{name: "wrong field count", profile: "mode: set\na.go:1.1,2.2 1\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseGoCoverProfile(tt.profile)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseGoCoverProfile() error = %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("parseGoCoverProfile() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCobertura(t *testing.T) {
+	tests := []struct {
+		name    string
+		report  string
+		want    float64
+		wantErr bool
+	}{
+		{
+			name:   "line counts preferred over the rounded rate",
+			report: `<?xml version="1.0" ?><coverage line-rate="0.67" lines-covered="2" lines-valid="3"><packages/></coverage>`,
+			want:   200.0 / 3,
+		},
+		{
+			name:   "line rate only",
+			report: `<coverage line-rate="0.825" branch-rate="0"></coverage>`,
+			want:   82.5,
+		},
+		{
+			name:   "no valid lines falls back to the rate",
+			report: `<coverage line-rate="1" lines-covered="0" lines-valid="0"></coverage>`,
+			want:   100,
+		},
+		{name: "no rate", report: `<coverage></coverage>`, wantErr: true},
+		{name: "not cobertura", report: `<report name="jacoco"></report>`, wantErr: true},
+		{name: "not xml", report: `mode: set`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseCobertura([]byte(tt.report))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseCobertura() error = %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("parseCobertura() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseLCOV(t *testing.T) {
+	tests := []struct {
+		name    string
+		report  string
+		want    float64
+		wantErr bool
+	}{
+		{
+			name: "records are summed",
+			report: `TN:
+SF:src/a.js
+DA:1,1
+LF:10
+LH:8
+end_of_record
+SF:src/b.js
+LF:10
+LH:2
+end_of_record
+`,
+			want: 50,
+		},
+		{name: "crlf line endings", report: "SF:a.js\r\nLF:4\r\nLH:3\r\nend_of_record\r\n", want: 75},
+		{name: "no lines", report: "TN:\nend_of_record\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseLCOV(tt.report)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseLCOV() error = %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("parseLCOV() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDetectCoverageFormat(t *testing.T) {
+	tests := map[string]string{
+		"mode: set\na.go:1.1,2.2 1 1\n":        coverageGo,
+		"<?xml version=\"1.0\"?>\n<coverage/>": coverageCobertura,
+		"TN:\nSF:a.js\nend_of_record\n":        coverageLCOV,
+		"SF:a.js\nLF:1\nLH:1\n":                coverageLCOV,
+		"total: 80%":                           "",
+	}
+	for content, want := range tests {
+		if got := detectCoverageFormat(content); got != want {
+			t.Errorf("detectCoverageFormat(%q) = %q, want %q", content, got, want)
+		}
+	}
+}
+
+func TestParseCoverageFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cover.out")
+	if err := os.WriteFile(path, []byte("mode: set\na.go:1.1,2.2 1 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := parseCoverageFile(path, coverageAuto); err != nil || got != 100 {
+		t.Errorf("parseCoverageFile(auto) = %v, %v", got, err)
+	}
+	if _, err := parseCoverageFile(path, coverageLCOV); err == nil {
+		t.Error("parseCoverageFile(lcov) of a Go profile succeeded")
+	}
+	if _, err := parseCoverageFile(filepath.Join(t.TempDir(), "missing"), coverageAuto); err == nil {
+		t.Error("parseCoverageFile() of a missing file succeeded")
+	}
+}
+
+func TestParseTestCounts(t *testing.T) {
+	tests := []struct {
+		name           string
+		output         string
+		passed, failed int
+		ok             bool
+	}{
+		{
+			name: "go test -v",
+			output: `=== RUN   TestA
+--- PASS: TestA (0.00s)
+=== RUN   TestB
+    --- PASS: TestB/sub (0.00s)
+--- FAIL: TestB (0.01s)
+FAIL
+`,
+			passed: 2, failed: 1, ok: true,
+		},
+		{
+			name: "go test -json",
+			output: `{"Time":"2026-01-01T00:00:00Z","Action":"run","Package":"p","Test":"TestA"}
+{"Time":"2026-01-01T00:00:00Z","Action":"output","Package":"p","Test":"TestA","Output":"--- PASS: TestA (0.00s)\n"}
+{"Time":"2026-01-01T00:00:00Z","Action":"pass","Package":"p","Test":"TestA","Elapsed":0}
+{"Time":"2026-01-01T00:00:00Z","Action":"fail","Package":"p","Test":"TestB","Elapsed":0}
+{"Time":"2026-01-01T00:00:00Z","Action":"skip","Package":"p","Test":"TestC","Elapsed":0}
+{"Time":"2026-01-01T00:00:00Z","Action":"fail","Package":"p","Elapsed":0.1}
+`,
+			passed: 1, failed: 1, ok: true,
+		},
+		{
+			name: "go test -json with other field order",
+			output: `{"Test":"TestA","Package":"p","Action":"pass"}
+{"Package":"p","Action":"pass","Test":"TestB"}
+{"Action":"pass","Package":"p"}
+`,
+			passed: 2, ok: true,
+		},
+		{
+			name:   "pytest summary",
+			output: "collected 100 items\n...\n===== 3 failed, 97 passed in 1.23s =====\n",
+			passed: 97, failed: 3, ok: true,
+		},
+		{
+			name:   "jest summary",
+			output: "Test Suites: 1 failed, 9 passed, 10 total\nTests:       2 failed, 98 passed, 100 total\n",
+			passed: 98, failed: 2, ok: true,
+		},
+		{
+			name:   "last summary wins",
+			output: "5 passed\nrerun:\n6 passed\n",
+			passed: 6, ok: true,
+		},
+		{name: "compile error", output: "# p\n./a.go:3:1: syntax error\nFAIL\tp [build failed]\n"},
+		{name: "empty", output: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			passed, failed, ok := parseTestCounts(tt.output)
+			if passed != tt.passed || failed != tt.failed || ok != tt.ok {
+				t.Errorf("parseTestCounts() = %d, %d, %v, want %d, %d, %v", passed, failed, ok, tt.passed, tt.failed, tt.ok)
+			}
+		})
+	}
+}
+
+func TestCoverageProblems(t *testing.T) {
+	defer func(c Config) { config = c }(config)
+
+	f := func(v float64) *float64 { return &v }
+	n := func(v int) *int { return &v }
+	tests := []struct {
+		name         string
+		min          float64
+		minTests     int
+		m, ref       coverageMeasurement
+		wantProblems []string
+	}{
+		{
+			name: "nothing measured either time",
+		},
+		{
+			name: "unchanged",
+			m:    coverageMeasurement{Percent: f(80), TestsPassed: n(10), TestsFailed: n(0)},
+			ref:  coverageMeasurement{Percent: f(80), TestsPassed: n(10), TestsFailed: n(0)},
+		},
+		{
+			name: "rounding is not a drop",
+			m:    coverageMeasurement{Percent: f(79.995)},
+			ref:  coverageMeasurement{Percent: f(80)},
+		},
+		{
+			name:         "coverage fell",
+			m:            coverageMeasurement{Percent: f(70)},
+			ref:          coverageMeasurement{Percent: f(80)},
+			wantProblems: []string{"coverage fell from 80.0% to 70.0%"},
+		},
+		{
+			name:         "below minimum",
+			min:          75,
+			m:            coverageMeasurement{Percent: f(74)},
+			wantProblems: []string{"coverage 74.0% is below the 75% minimum"},
+		},
+		{
+			name:         "tests lost and failing",
+			minTests:     10,
+			m:            coverageMeasurement{TestsPassed: n(8), TestsFailed: n(2)},
+			ref:          coverageMeasurement{TestsPassed: n(10), TestsFailed: n(0)},
+			wantProblems: []string{"8 passing tests is below the minimum of 10", "passing tests fell from 10 to 8", "failing tests rose from 0 to 2"},
+		},
+		{
+			name:         "nothing measurable any more",
+			ref:          coverageMeasurement{Percent: f(80), TestsPassed: n(10)},
+			wantProblems: []string{"coverage could no longer be measured (was 80.0%)", "tests could no longer be counted (10 passed before)"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.CoverageMin, config.CoverageMinTests = tt.min, tt.minTests
+			got := coverageProblems(tt.m, tt.ref)
+			if strings.Join(got, "\n") != strings.Join(tt.wantProblems, "\n") {
+				t.Errorf("coverageProblems() = %q, want %q", got, tt.wantProblems)
+			}
+		})
+	}
+}
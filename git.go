@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// gitOutput runs git with the given arguments and returns its trimmed stdout.
+func gitOutput(args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		return "", fmt.Errorf("git %s: %s", strings.Join(args, " "), msg)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// isGitRepo reports whether the current directory is inside a git work tree.
+func isGitRepo() bool {
+	out, err := gitOutput("rev-parse", "--is-inside-work-tree")
+	return err == nil && out == "true"
+}
+
+// gitUntracked returns the untracked (and not ignored) files in the work tree.
+func gitUntracked() (map[string]bool, error) {
+	out, err := gitOutput("ls-files", "--others", "--exclude-standard")
+	if err != nil {
+		return nil, err
+	}
+	files := map[string]bool{}
+	for _, line := range strings.Split(out, "\n") {
+		if line != "" {
+			files[line] = true
+		}
+	}
+	return files, nil
+}
+
+// workspaceSnapshot captures enough of the work tree before an iteration to
+// undo everything the iteration did: commits, edits, new files, notes and
+// checked requirements.
+type workspaceSnapshot struct {
+	Head      string
+	Stash     string // "git stash create" commit for uncommitted changes, if any
+	Untracked map[string]bool
+	files     map[string][]byte // specs and notes files, restored byte for byte (nil = did not exist)
+}
+
+// takeSnapshot records the work tree state without modifying it.
+func takeSnapshot() (*workspaceSnapshot, error) {
+	defer startSpan("git snapshot").end()
+
+	head, err := gitOutput("rev-parse", "HEAD")
+	if err != nil {
+		return nil, err
+	}
+	stash, err := gitOutput("stash", "create")
+	if err != nil {
+		return nil, err
+	}
+	untracked, err := gitUntracked()
+	if err != nil {
+		return nil, err
+	}
+
+	snap := &workspaceSnapshot{Head: head, Stash: stash, Untracked: untracked, files: map[string][]byte{}}
+	for _, path := range []string{config.SpecsFile, config.NotesFile, structuredNotesFile()} {
+		if path == "" {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		snap.files[path] = data
+	}
+	return snap, nil
+}
+
+// base is the commit representing the work tree at snapshot time.
+func (s *workspaceSnapshot) base() string {
+	if s.Stash != "" {
+		return s.Stash
+	}
+	return s.Head
+}
+
+// diffStat summarises the changes made since the snapshot.
+func (s *workspaceSnapshot) diffStat() string {
+	var b strings.Builder
+	stat, err := gitOutput("diff", "--stat", s.base())
+	if err != nil {
+		b.WriteString(fmt.Sprintf("(git diff failed: %v)\n", err))
+	} else if stat != "" {
+		b.WriteString(stat + "\n")
+	}
+	if now, err := gitUntracked(); err == nil {
+		for path := range now {
+			if !s.Untracked[path] {
+				b.WriteString(fmt.Sprintf(" %s (new, untracked)\n", path))
+			}
+		}
+	}
+	if b.Len() == 0 {
+		return "(no changes)\n"
+	}
+	return b.String()
+}
+
+// restore rewinds the work tree to the snapshot: it resets to the old HEAD,
+// re-applies the uncommitted changes that existed before, deletes files the
+// iteration created and restores the specs and notes, even when they are
+// not tracked by git.
+func (s *workspaceSnapshot) restore() error {
+	defer startSpan("git restore").end()
+
+	now, err := gitUntracked()
+	if err != nil {
+		return err
+	}
+	if _, err := gitOutput("reset", "--hard", s.Head); err != nil {
+		return err
+	}
+	if s.Stash != "" {
+		if _, err := gitOutput("stash", "apply", s.Stash); err != nil {
+			return err
+		}
+	}
+	for path := range now {
+		if s.Untracked[path] {
+			continue
+		}
+		if _, keep := s.files[path]; keep {
+			continue
+		}
+		// aider-ralph's own state (sessions, answers, ...) is not the iteration's work
+		if strings.HasPrefix(filepath.ToSlash(path), ralphDir+"/") {
+			continue
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	for path, data := range s.files {
+		if data == nil {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			continue
+		}
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Hook points.
+const (
+	hookPreIteration  = "pre-iteration"
+	hookPostIteration = "post-iteration"
+	hookOnComplete    = "on-complete"
+	hookOnFailure     = "on-failure"
+)
+
+// What a failing pre- or post-iteration hook does to the loop.
+const (
+	hookFailureAbort  = "abort"  // stop the loop (exit code 1)
+	hookFailureSkip   = "skip"   // skip (pre) or void (post) the iteration
+	hookFailureIgnore = "ignore" // log it and carry on
+)
+
+// maxHookSkips is how many iterations in a row a failing pre-iteration hook
+// may skip before the loop gives up, so a hook that always fails cannot
+// keep it spinning.
+const maxHookSkips = 3
+
+// configFile holds project defaults; only the hook settings are read.
+var configFile = filepath.Join(ralphDir, "config")
+
+// hookResult is the outcome of one hook command.
+type hookResult struct {
+	Hook string `json:"hook"`
+	verifyResult
+}
+
+// loadHookConfig fills in hook settings not given on the command line from
+// .ralph/config: PRE_ITERATION, POST_ITERATION, ON_COMPLETE and ON_FAILURE
+// (one command per line, repeatable) and HOOK_FAILURE.
+func loadHookConfig() error {
+	f, err := os.Open(configFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+
+	fromFile := map[string][]string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		key = strings.TrimSpace(key)
+		fromFile[key] = append(fromFile[key], value)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	for key, target := range map[string]*[]string{
+		"PRE_ITERATION":  &config.PreIteration,
+		"POST_ITERATION": &config.PostIteration,
+		"ON_COMPLETE":    &config.OnComplete,
+		"ON_FAILURE":     &config.OnFailure,
+	} {
+		if len(*target) == 0 {
+			*target = fromFile[key]
+		}
+	}
+	if values := fromFile["HOOK_FAILURE"]; config.HookFailure == "" && len(values) > 0 {
+		config.HookFailure = values[len(values)-1]
+	}
+	return nil
+}
+
+// hookEnv is the environment hooks run with: aider-ralph's own plus
+// RALPH_* variables describing the loop. rec is nil before an iteration.
+func hookEnv(hook string, iteration int, rec *iterationRecord, result string, exitCode int) []string {
+	vars := map[string]string{
+		"RALPH_HOOK":       hook,
+		"RALPH_ITERATION":  strconv.Itoa(iteration),
+		"RALPH_SPECS_FILE": config.SpecsFile,
+		"RALPH_NOTES_FILE": config.NotesFile,
+	}
+	if session != nil {
+		vars["RALPH_SESSION"] = session.ID
+		vars["RALPH_SESSION_DIR"] = session.dir()
+	}
+	if rec != nil {
+		vars["RALPH_STATUS"] = rec.Status
+		vars["RALPH_OUTCOME"] = rec.Outcome
+	}
+	if result != "" {
+		vars["RALPH_RESULT"] = result
+		vars["RALPH_EXIT_CODE"] = strconv.Itoa(exitCode)
+	}
+	env := os.Environ()
+	for k, v := range vars {
+		env = append(env, k+"="+v)
+	}
+	return env
+}
+
+// runHooks runs the commands of a hook in order, stopping at the first
+// one that fails, and reports whether all of them passed.
+func runHooks(hook string, commands, env []string, logWriter io.Writer) ([]hookResult, bool) {
+	var results []hookResult
+	for _, command := range commands {
+		inject, command := parseInjectPrefix(hook, command)
+		if config.DryRun {
+			logInfo(fmt.Sprintf("[DRY RUN] Would run %s hook: %s", hook, command))
+			continue
+		}
+		logInfo(fmt.Sprintf("Running %s hook: %s", hook, command))
+		hookSpan := startSpan("hook " + hook)
+		r := runShellCommand(command, env)
+		endVerifySpan(hookSpan, r)
+		results = append(results, hookResult{Hook: hook, verifyResult: r})
+		if inject != "" {
+			injectOutput(inject, r)
+		}
+
+		if logWriter != nil {
+			fmt.Fprintf(logWriter, "=== Hook %s: %s (exit %d) ===\n%s\n", hook, command, r.ExitCode, r.Output)
+		}
+		if r.Passed {
+			continue
+		}
+		if r.TimedOut {
+			logError(fmt.Sprintf("%s hook timed out after %ds: %s", hook, config.Timeout, command))
+		} else {
+			logError(fmt.Sprintf("%s hook failed (exit %d): %s", hook, r.ExitCode, command))
+		}
+		if out := tailText(r.Output, verifyOutputTail); out != "" {
+			fmt.Println(out)
+		}
+		return results, false
+	}
+	return results, true
+}
+
+// runPreIterationHooks runs the pre-iteration hooks. The action is "" when
+// the iteration should go ahead, else the --hook-failure policy to apply.
+func runPreIterationHooks(iteration int, logWriter io.Writer) ([]hookResult, string) {
+	if len(config.PreIteration) == 0 {
+		return nil, ""
+	}
+	results, ok := runHooks(hookPreIteration, config.PreIteration, hookEnv(hookPreIteration, iteration, nil, "", 0), logWriter)
+	if ok || config.HookFailure == hookFailureIgnore {
+		return results, ""
+	}
+	return results, config.HookFailure
+}
+
+// runPostIterationHooks runs the post-iteration hooks after rec's iteration.
+// With the skip policy a failure voids the iteration: its status (and so
+// any claim of completion) is dropped. It returns the policy to apply, or
+// "" to carry on.
+func runPostIterationHooks(rec *iterationRecord, logWriter io.Writer) string {
+	if len(config.PostIteration) == 0 {
+		return ""
+	}
+	results, ok := runHooks(hookPostIteration, config.PostIteration, hookEnv(hookPostIteration, rec.Iteration, rec, "", 0), logWriter)
+	rec.Hooks = append(rec.Hooks, results...)
+	if ok || config.HookFailure == hookFailureIgnore {
+		return ""
+	}
+	if config.HookFailure == hookFailureSkip {
+		if rec.Status != "" {
+			logWarn(fmt.Sprintf("Ignoring the reported %s status: the post-iteration hook failed", rec.Status))
+		}
+		rec.Outcome = "hook_failed"
+		rec.Status, rec.StatusReason = "", "post-iteration hook failed"
+		return ""
+	}
+	return config.HookFailure
+}
+
+// hookFailedRecord records an iteration skipped or stopped by a failing
+// pre-iteration hook.
+func hookFailedRecord(iteration int, results []hookResult) iterationRecord {
+	now := time.Now()
+	return iterationRecord{
+		Iteration:    iteration,
+		StartedAt:    now,
+		EndedAt:      now,
+		Outcome:      "hook_failed",
+		StatusReason: "pre-iteration hook failed",
+		Hooks:        results,
+	}
+}
+
+// runLoopEndHooks runs the on-complete hooks if the loop completed, else
+// the on-failure hooks. Their failures are only logged.
+func runLoopEndHooks(result string, exitCode, iteration int, logWriter io.Writer) {
+	hook, commands := hookOnFailure, config.OnFailure
+	if result == "completed" {
+		hook, commands = hookOnComplete, config.OnComplete
+	}
+	if len(commands) == 0 {
+		return
+	}
+	var rec *iterationRecord
+	if session != nil {
+		rec = session.lastRecord()
+	}
+	runHooks(hook, commands, hookEnv(hook, iteration, rec, result, exitCode), logWriter)
+}
+
+// hooksArtifact renders hook runs for an iteration's hooks.txt artifact.
+func hooksArtifact(results []hookResult) string {
+	var b strings.Builder
+	for _, r := range results {
+		fmt.Fprintf(&b, "# %s\n", r.Hook)
+		b.WriteString(verifyArtifact([]verifyResult{r.verifyResult}))
+	}
+	return b.String()
+}
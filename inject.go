@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// defaultInjectMaxBytes caps the output one injected command adds to the
+// prompt.
+const defaultInjectMaxBytes = 8000
+
+// injectPrefixRe matches the "[inject]" or "[inject=NAME]" prefix that
+// marks a hook or verify command whose output goes into the next prompt.
+var injectPrefixRe = regexp.MustCompile(`^\[inject(?:=([A-Za-z][A-Za-z0-9_-]*))?\]\s*`)
+
+// injectedOutput is the latest output of one injected command.
+type injectedOutput struct {
+	Name     string
+	Command  string
+	ExitCode int
+	TimedOut bool
+	Output   string
+}
+
+// injections holds the output of injected commands, in the order they
+// first ran; a command's next run replaces its output.
+var injections struct {
+	mu      sync.Mutex
+	outputs []injectedOutput
+}
+
+// parseInjectPrefix strips an inject prefix from command. name is the
+// prompt section the output goes into ("" if the command is not injected);
+// without an explicit NAME it is derived from kind, e.g. VERIFY_OUTPUT.
+func parseInjectPrefix(kind, command string) (name, stripped string) {
+	m := injectPrefixRe.FindStringSubmatch(command)
+	if m == nil {
+		return "", command
+	}
+	name = m[1]
+	if name == "" {
+		name = kind + "_output"
+	}
+	name = strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+	return name, command[len(m[0]):]
+}
+
+// checkInjectPrefix rejects a malformed inject prefix, which would
+// otherwise be run as part of the command.
+func checkInjectPrefix(option, command string) error {
+	if strings.HasPrefix(command, "[inject") && !injectPrefixRe.MatchString(command) {
+		return fmt.Errorf("invalid inject prefix in %s %q (expected [inject] or [inject=NAME])", option, command)
+	}
+	if name, stripped := parseInjectPrefix("", command); name != "" && strings.TrimSpace(stripped) == "" {
+		return fmt.Errorf("%s %q has no command after the inject prefix", option, command)
+	}
+	return nil
+}
+
+// injectOutput keeps r's output for the next prompt under name.
+func injectOutput(name string, r verifyResult) {
+	out := injectedOutput{
+		Name:     name,
+		Command:  r.Command,
+		ExitCode: r.ExitCode,
+		TimedOut: r.TimedOut,
+		Output:   strings.TrimSpace(r.Output),
+	}
+	if config.InjectMaxBytes > 0 {
+		out.Output = tailText(out.Output, config.InjectMaxBytes)
+	}
+
+	injections.mu.Lock()
+	defer injections.mu.Unlock()
+	for i := range injections.outputs {
+		if injections.outputs[i].Name == name && injections.outputs[i].Command == out.Command {
+			injections.outputs[i] = out
+			return
+		}
+	}
+	injections.outputs = append(injections.outputs, out)
+}
+
+// renderInjections renders the injected command outputs as prompt
+// sections, one per command.
+func renderInjections() string {
+	injections.mu.Lock()
+	defer injections.mu.Unlock()
+	var b strings.Builder
+	for _, o := range injections.outputs {
+		result := fmt.Sprintf("exit code %d", o.ExitCode)
+		if o.TimedOut {
+			result = "timed out"
+		}
+		fmt.Fprintf(&b, "=== %s (output of `%s`, %s) ===\n", o.Name, o.Command, result)
+		if o.Output == "" {
+			b.WriteString("(no output)\n")
+		} else {
+			b.WriteString(o.Output + "\n")
+		}
+		fmt.Fprintf(&b, "=== END %s ===\n\n", o.Name)
+	}
+	return b.String()
+}
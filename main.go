@@ -1,8 +1,6 @@
 package main
 
 import (
-	"bufio"
-	"context"
 	_ "embed"
 	"fmt"
 	"io"
@@ -29,6 +27,18 @@ var embeddedPromptTemplate string
 //go:embed templates/CONVENTIONS.md
 var embeddedConventionsTemplate string
 
+//go:embed templates/COMPACT_NOTES.md
+var embeddedCompactNotesPrompt string
+
+//go:embed templates/AUDIT.md
+var embeddedAuditPrompt string
+
+//go:embed templates/RESOLVE_CONFLICTS.md
+var embeddedResolveConflictsPrompt string
+
+//go:embed templates/DASHBOARD.html
+var embeddedDashboard string
+
 // ANSI color codes
 const (
 	colorReset  = "\033[0m"
@@ -55,6 +65,12 @@ type Config struct {
 
 	NotesFile string
 
+	PromptBudget int // maximum prompt size in characters (0 = unlimited)
+
+	ConventionsFile string
+	ConventionsMode string // "inject" (prompt section) or "read" (aider --read)
+	NoConventions   bool
+
 	Delay   int
 	Timeout int // Timeout per iteration in seconds (0 = no timeout)
 
@@ -65,17 +81,100 @@ type Config struct {
 	DoInit      bool
 	ProjectName string
 	ShowVersion bool
+
+	StdinMode string // how aider's stdin is wired: inherit or null
+
+	Approve bool // ask a human to approve each iteration's changes
+
+	ConfirmCompletion bool // run an audit iteration before accepting completion
+
+	EarlyStop      bool // stop aider once a status tag has streamed by
+	EarlyStopGrace int  // seconds aider may keep running after the status tag
+
+	StatusActions map[string]statusAction // loop action per reported status
+	AnswersFile   string                  // human answers for NEEDS_INPUT
+
+	CompactNotesEvery int // compact the notes file every N iterations (0 = never)
+
+	Parallel int // loops run at once by the "run" command
+
+	TaskMode        string // who picks each iteration's requirement: self or driver
+	TaskMaxAttempts int    // failed attempts before the driver skips a requirement
+
+	GraphFormat string // "specs graph" output: dot or mermaid
+
+	LintStrict    bool // lint warnings fail "specs lint" and "run" too
+	MaxItemLength int  // longest requirement text lint accepts without a warning
+	NoLint        bool // skip the specs lint "run" does before starting loops
+
+	ReportSession  string // session "report" covers (default: the latest)
+	ReportMarkdown string // file "report" writes Markdown to
+	ReportHTML     string // file "report" writes HTML to
+
+	Serve      string // address of the HTTP status API and dashboard, e.g. ":8080"
+	ServeToken string // token required by the API's pause/resume/stop endpoints
+
+	TraceFile     string // file OTLP/JSON trace spans are appended to
+	TraceEndpoint string // OTLP/HTTP collector trace spans are posted to
+
+	PreIteration  []string // shell commands run before each iteration
+	PostIteration []string // shell commands run after each iteration
+	OnComplete    []string // shell commands run when the loop completes
+	OnFailure     []string // shell commands run when the loop ends without completing
+	HookFailure   string   // what a failing pre/post-iteration hook does: abort, skip or ignore
+
+	InjectMaxBytes int // cap on the output an [inject] command adds to the prompt (0 = unlimited)
+
+	CoverageCmd      string  // shell command that produces the coverage report and runs the tests
+	CoverageFile     string  // coverage report written by CoverageCmd
+	CoverageFormat   string  // report format: auto, go, cobertura or lcov
+	CoverageMin      float64 // minimum coverage in percent (0 = only guard against drops)
+	CoverageMinTests int     // minimum number of passing tests (0 = only guard against drops)
+	CoverageAction   string  // what a regression does to the iteration: fail or revert
+
+	NotifyWebhooks []string // URLs loop events are posted to as JSON
+	NotifyCmds     []string // shell command templates run on loop events
+	NotifyFailures int      // consecutive failed iterations that trigger repeated_failures
+	NotifyStall    int      // iterations without a checked requirement that trigger stalled
+
+	Verify           []string // shell commands that must pass after each iteration and merge
+	ResolveConflicts bool     // let aider resolve merge conflicts ("merge" command)
+
+	Command     string   // subcommand, e.g. "notes"
+	CommandArgs []string // positional arguments following the subcommand
 }
 
 var config Config
 var loopActive bool
 
+// commands lists the subcommands accepted as the first argument.
+var commands = map[string]bool{
+	"notes":  true,
+	"run":    true,
+	"merge":  true,
+	"specs":  true,
+	"report": true,
+}
+
+// rawOutputCommands write output meant for other tools (e.g. a DOT graph)
+// to stdout, so no banner is printed before it.
+var rawOutputCommands = map[string]bool{
+	"specs":  true,
+	"report": true,
+}
+
 const defaultSpecsFile = "SPECS.md"
 const defaultPromptFile = "PROMPT.md"
+const defaultConventionsFile = "CONVENTIONS.md"
+const defaultConventionsMode = "inject"
 const defaultCompletionTag = "ralph_status"
 const defaultCompletionValue = "COMPLETED"
 const defaultMaxIterations = 30
 
+// defaultEarlyStopGrace gives aider time to apply edits and commit after the
+// status tag before --early-stop stops it.
+const defaultEarlyStopGrace = 30
+
 func main() {
 	parseArgs()
 
@@ -84,13 +183,19 @@ func main() {
 		os.Exit(0)
 	}
 
-	printBanner()
+	if !rawOutputCommands[config.Command] {
+		printBanner()
+	}
 
 	if config.DoInit {
 		initProject()
 		os.Exit(0)
 	}
 
+	if config.Command != "" {
+		os.Exit(runCommand())
+	}
+
 	if err := validate(); err != nil {
 		logError(err.Error())
 		os.Exit(1)
@@ -103,7 +208,24 @@ func main() {
 	showConfig()
 
 	// Run the main loop
-	mainLoop()
+	os.Exit(mainLoop())
+}
+
+// runCommand dispatches a subcommand and returns the process exit code.
+func runCommand() int {
+	switch config.Command {
+	case "notes":
+		return runNotesCommand(config.CommandArgs)
+	case "run":
+		return runRunCommand(config.CommandArgs)
+	case "merge":
+		return runMergeCommand(config.CommandArgs)
+	case "specs":
+		return runSpecsCommand(config.CommandArgs)
+	case "report":
+		return runReportCommand(config.CommandArgs)
+	}
+	return 1
 }
 
 func parseArgs() {
@@ -115,6 +237,21 @@ func parseArgs() {
 	config.CompletionTag = defaultCompletionTag
 	config.CompletionValue = defaultCompletionValue
 	config.MaxIterations = defaultMaxIterations
+	config.ConventionsMode = defaultConventionsMode
+	config.StatusActions = defaultStatusActions()
+	config.AnswersFile = defaultAnswersFile
+	config.StdinMode = stdinNull
+	config.EarlyStopGrace = defaultEarlyStopGrace
+	config.Parallel = defaultParallel
+	config.TaskMode = taskModeSelf
+	config.GraphFormat = "dot"
+	config.MaxItemLength = defaultMaxItemLength
+	config.TaskMaxAttempts = defaultTaskMaxAttempts
+	config.NotifyFailures = defaultNotifyFailures
+	config.InjectMaxBytes = defaultInjectMaxBytes
+	config.CoverageFormat = coverageAuto
+	config.CoverageAction = coverageActionFail
+	config.NotifyStall = defaultNotifyStall
 
 	// First, find and extract aider options after --
 	for i, arg := range args {
@@ -125,6 +262,12 @@ func parseArgs() {
 		}
 	}
 
+	// Subcommands (e.g. "notes compact") must come first
+	if len(args) > 0 && commands[args[0]] {
+		config.Command = args[0]
+		args = args[1:]
+	}
+
 	// Parse remaining args manually
 	i := 0
 	var positionalArgs []string
@@ -182,6 +325,289 @@ func parseArgs() {
 			} else {
 				i++
 			}
+		case "--stdin":
+			if i+1 < len(args) {
+				config.StdinMode = args[i+1]
+				i += 2
+			} else {
+				i++
+			}
+		case "--pty":
+			config.StdinMode = stdinPTY
+			i++
+		case "--approve":
+			config.Approve = true
+			i++
+		case "--confirm-completion":
+			config.ConfirmCompletion = true
+			i++
+		case "--task-mode":
+			if i+1 < len(args) {
+				config.TaskMode = args[i+1]
+				i += 2
+			} else {
+				i++
+			}
+		case "--task-max-attempts":
+			if i+1 < len(args) {
+				fmt.Sscanf(args[i+1], "%d", &config.TaskMaxAttempts)
+				i += 2
+			} else {
+				i++
+			}
+		case "--serve":
+			if i+1 < len(args) {
+				config.Serve = args[i+1]
+				i += 2
+			} else {
+				i++
+			}
+		case "--serve-token":
+			if i+1 < len(args) {
+				config.ServeToken = args[i+1]
+				i += 2
+			} else {
+				i++
+			}
+		case "--trace-file":
+			if i+1 < len(args) {
+				config.TraceFile = args[i+1]
+				i += 2
+			} else {
+				i++
+			}
+		case "--trace-endpoint":
+			if i+1 < len(args) {
+				config.TraceEndpoint = args[i+1]
+				i += 2
+			} else {
+				i++
+			}
+		case "--pre-iteration":
+			if i+1 < len(args) {
+				config.PreIteration = append(config.PreIteration, args[i+1])
+				i += 2
+			} else {
+				i++
+			}
+		case "--post-iteration":
+			if i+1 < len(args) {
+				config.PostIteration = append(config.PostIteration, args[i+1])
+				i += 2
+			} else {
+				i++
+			}
+		case "--on-complete":
+			if i+1 < len(args) {
+				config.OnComplete = append(config.OnComplete, args[i+1])
+				i += 2
+			} else {
+				i++
+			}
+		case "--on-failure":
+			if i+1 < len(args) {
+				config.OnFailure = append(config.OnFailure, args[i+1])
+				i += 2
+			} else {
+				i++
+			}
+		case "--inject-max-bytes":
+			if i+1 < len(args) {
+				fmt.Sscanf(args[i+1], "%d", &config.InjectMaxBytes)
+				i += 2
+			} else {
+				i++
+			}
+		case "--hook-failure":
+			if i+1 < len(args) {
+				config.HookFailure = args[i+1]
+				i += 2
+			} else {
+				i++
+			}
+		case "--coverage-cmd":
+			if i+1 < len(args) {
+				config.CoverageCmd = args[i+1]
+				i += 2
+			} else {
+				i++
+			}
+		case "--coverage-file":
+			if i+1 < len(args) {
+				config.CoverageFile = args[i+1]
+				i += 2
+			} else {
+				i++
+			}
+		case "--coverage-format":
+			if i+1 < len(args) {
+				config.CoverageFormat = args[i+1]
+				i += 2
+			} else {
+				i++
+			}
+		case "--coverage-min":
+			if i+1 < len(args) {
+				fmt.Sscanf(args[i+1], "%g", &config.CoverageMin)
+				i += 2
+			} else {
+				i++
+			}
+		case "--coverage-min-tests":
+			if i+1 < len(args) {
+				fmt.Sscanf(args[i+1], "%d", &config.CoverageMinTests)
+				i += 2
+			} else {
+				i++
+			}
+		case "--coverage-action":
+			if i+1 < len(args) {
+				config.CoverageAction = args[i+1]
+				i += 2
+			} else {
+				i++
+			}
+		case "--notify-webhook":
+			if i+1 < len(args) {
+				config.NotifyWebhooks = append(config.NotifyWebhooks, args[i+1])
+				i += 2
+			} else {
+				i++
+			}
+		case "--notify-cmd":
+			if i+1 < len(args) {
+				config.NotifyCmds = append(config.NotifyCmds, args[i+1])
+				i += 2
+			} else {
+				i++
+			}
+		case "--notify-failures":
+			if i+1 < len(args) {
+				fmt.Sscanf(args[i+1], "%d", &config.NotifyFailures)
+				i += 2
+			} else {
+				i++
+			}
+		case "--notify-stall":
+			if i+1 < len(args) {
+				fmt.Sscanf(args[i+1], "%d", &config.NotifyStall)
+				i += 2
+			} else {
+				i++
+			}
+		case "--session":
+			if i+1 < len(args) {
+				config.ReportSession = args[i+1]
+				i += 2
+			} else {
+				i++
+			}
+		case "--markdown":
+			if i+1 < len(args) {
+				config.ReportMarkdown = args[i+1]
+				i += 2
+			} else {
+				i++
+			}
+		case "--html":
+			if i+1 < len(args) {
+				config.ReportHTML = args[i+1]
+				i += 2
+			} else {
+				i++
+			}
+		case "--strict":
+			config.LintStrict = true
+			i++
+		case "--no-lint":
+			config.NoLint = true
+			i++
+		case "--max-item-length":
+			if i+1 < len(args) {
+				fmt.Sscanf(args[i+1], "%d", &config.MaxItemLength)
+				i += 2
+			} else {
+				i++
+			}
+		case "--format":
+			if i+1 < len(args) {
+				config.GraphFormat = args[i+1]
+				i += 2
+			} else {
+				i++
+			}
+		case "--verify":
+			if i+1 < len(args) {
+				config.Verify = append(config.Verify, args[i+1])
+				i += 2
+			} else {
+				i++
+			}
+		case "--resolve-conflicts":
+			config.ResolveConflicts = true
+			i++
+		case "--parallel":
+			if i+1 < len(args) {
+				fmt.Sscanf(args[i+1], "%d", &config.Parallel)
+				i += 2
+			} else {
+				i++
+			}
+		case "--early-stop":
+			config.EarlyStop = true
+			i++
+		case "--early-stop-grace":
+			if i+1 < len(args) {
+				fmt.Sscanf(args[i+1], "%d", &config.EarlyStopGrace)
+				i += 2
+			} else {
+				i++
+			}
+		case "--on-status":
+			if i+1 < len(args) {
+				setStatusAction(args[i+1])
+				i += 2
+			} else {
+				i++
+			}
+		case "--answers-file":
+			if i+1 < len(args) {
+				config.AnswersFile = args[i+1]
+				i += 2
+			} else {
+				i++
+			}
+		case "--compact-notes-every":
+			if i+1 < len(args) {
+				fmt.Sscanf(args[i+1], "%d", &config.CompactNotesEvery)
+				i += 2
+			} else {
+				i++
+			}
+		case "--prompt-budget":
+			if i+1 < len(args) {
+				config.PromptBudget = mustParsePromptBudget(args[i+1])
+				i += 2
+			} else {
+				i++
+			}
+		case "--conventions":
+			if i+1 < len(args) {
+				config.ConventionsFile = args[i+1]
+				i += 2
+			} else {
+				i++
+			}
+		case "--conventions-mode":
+			if i+1 < len(args) {
+				config.ConventionsMode = args[i+1]
+				i += 2
+			} else {
+				i++
+			}
+		case "--no-conventions":
+			config.NoConventions = true
+			i++
 		case "-d", "--delay":
 			if i+1 < len(args) {
 				fmt.Sscanf(args[i+1], "%d", &config.Delay)
@@ -242,6 +668,80 @@ func parseArgs() {
 				config.SpecsFile = arg[8:]
 			} else if strings.HasPrefix(arg, "--notes-file=") {
 				config.NotesFile = arg[len("--notes-file="):]
+			} else if strings.HasPrefix(arg, "--stdin=") {
+				config.StdinMode = arg[len("--stdin="):]
+			} else if strings.HasPrefix(arg, "--on-status=") {
+				setStatusAction(arg[len("--on-status="):])
+			} else if strings.HasPrefix(arg, "--task-mode=") {
+				config.TaskMode = arg[len("--task-mode="):]
+			} else if strings.HasPrefix(arg, "--task-max-attempts=") {
+				fmt.Sscanf(arg[len("--task-max-attempts="):], "%d", &config.TaskMaxAttempts)
+			} else if strings.HasPrefix(arg, "--serve=") {
+				config.Serve = arg[len("--serve="):]
+			} else if strings.HasPrefix(arg, "--serve-token=") {
+				config.ServeToken = arg[len("--serve-token="):]
+			} else if strings.HasPrefix(arg, "--trace-file=") {
+				config.TraceFile = arg[len("--trace-file="):]
+			} else if strings.HasPrefix(arg, "--trace-endpoint=") {
+				config.TraceEndpoint = arg[len("--trace-endpoint="):]
+			} else if strings.HasPrefix(arg, "--pre-iteration=") {
+				config.PreIteration = append(config.PreIteration, arg[len("--pre-iteration="):])
+			} else if strings.HasPrefix(arg, "--post-iteration=") {
+				config.PostIteration = append(config.PostIteration, arg[len("--post-iteration="):])
+			} else if strings.HasPrefix(arg, "--on-complete=") {
+				config.OnComplete = append(config.OnComplete, arg[len("--on-complete="):])
+			} else if strings.HasPrefix(arg, "--on-failure=") {
+				config.OnFailure = append(config.OnFailure, arg[len("--on-failure="):])
+			} else if strings.HasPrefix(arg, "--inject-max-bytes=") {
+				fmt.Sscanf(arg[len("--inject-max-bytes="):], "%d", &config.InjectMaxBytes)
+			} else if strings.HasPrefix(arg, "--hook-failure=") {
+				config.HookFailure = arg[len("--hook-failure="):]
+			} else if strings.HasPrefix(arg, "--coverage-cmd=") {
+				config.CoverageCmd = arg[len("--coverage-cmd="):]
+			} else if strings.HasPrefix(arg, "--coverage-file=") {
+				config.CoverageFile = arg[len("--coverage-file="):]
+			} else if strings.HasPrefix(arg, "--coverage-format=") {
+				config.CoverageFormat = arg[len("--coverage-format="):]
+			} else if strings.HasPrefix(arg, "--coverage-min=") {
+				fmt.Sscanf(arg[len("--coverage-min="):], "%g", &config.CoverageMin)
+			} else if strings.HasPrefix(arg, "--coverage-min-tests=") {
+				fmt.Sscanf(arg[len("--coverage-min-tests="):], "%d", &config.CoverageMinTests)
+			} else if strings.HasPrefix(arg, "--coverage-action=") {
+				config.CoverageAction = arg[len("--coverage-action="):]
+			} else if strings.HasPrefix(arg, "--notify-webhook=") {
+				config.NotifyWebhooks = append(config.NotifyWebhooks, arg[len("--notify-webhook="):])
+			} else if strings.HasPrefix(arg, "--notify-cmd=") {
+				config.NotifyCmds = append(config.NotifyCmds, arg[len("--notify-cmd="):])
+			} else if strings.HasPrefix(arg, "--notify-failures=") {
+				fmt.Sscanf(arg[len("--notify-failures="):], "%d", &config.NotifyFailures)
+			} else if strings.HasPrefix(arg, "--notify-stall=") {
+				fmt.Sscanf(arg[len("--notify-stall="):], "%d", &config.NotifyStall)
+			} else if strings.HasPrefix(arg, "--session=") {
+				config.ReportSession = arg[len("--session="):]
+			} else if strings.HasPrefix(arg, "--markdown=") {
+				config.ReportMarkdown = arg[len("--markdown="):]
+			} else if strings.HasPrefix(arg, "--html=") {
+				config.ReportHTML = arg[len("--html="):]
+			} else if strings.HasPrefix(arg, "--max-item-length=") {
+				fmt.Sscanf(arg[len("--max-item-length="):], "%d", &config.MaxItemLength)
+			} else if strings.HasPrefix(arg, "--format=") {
+				config.GraphFormat = arg[len("--format="):]
+			} else if strings.HasPrefix(arg, "--verify=") {
+				config.Verify = append(config.Verify, arg[len("--verify="):])
+			} else if strings.HasPrefix(arg, "--parallel=") {
+				fmt.Sscanf(arg[len("--parallel="):], "%d", &config.Parallel)
+			} else if strings.HasPrefix(arg, "--early-stop-grace=") {
+				fmt.Sscanf(arg[len("--early-stop-grace="):], "%d", &config.EarlyStopGrace)
+			} else if strings.HasPrefix(arg, "--answers-file=") {
+				config.AnswersFile = arg[len("--answers-file="):]
+			} else if strings.HasPrefix(arg, "--compact-notes-every=") {
+				fmt.Sscanf(arg[len("--compact-notes-every="):], "%d", &config.CompactNotesEvery)
+			} else if strings.HasPrefix(arg, "--prompt-budget=") {
+				config.PromptBudget = mustParsePromptBudget(arg[len("--prompt-budget="):])
+			} else if strings.HasPrefix(arg, "--conventions=") {
+				config.ConventionsFile = arg[len("--conventions="):]
+			} else if strings.HasPrefix(arg, "--conventions-mode=") {
+				config.ConventionsMode = arg[len("--conventions-mode="):]
 			} else if strings.HasPrefix(arg, "-d=") {
 				fmt.Sscanf(arg[3:], "%d", &config.Delay)
 			} else if strings.HasPrefix(arg, "--delay=") {
@@ -275,6 +775,12 @@ func parseArgs() {
 		config.Timeout = 900
 	}
 
+	// Positional arguments belong to the subcommand, if any
+	if config.Command != "" {
+		config.CommandArgs = positionalArgs
+		return
+	}
+
 	// First positional argument is either project name (for init) or prompt
 	if len(positionalArgs) > 0 {
 		if config.DoInit {
@@ -285,6 +791,24 @@ func parseArgs() {
 	}
 }
 
+func setStatusAction(value string) {
+	status, action, err := parseStatusAction(value)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s%v%s\n", colorRed, err, colorReset)
+		os.Exit(1)
+	}
+	config.StatusActions[status] = action
+}
+
+func mustParsePromptBudget(value string) int {
+	budget, err := parsePromptBudget(value)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s%v%s\n", colorRed, err, colorReset)
+		os.Exit(1)
+	}
+	return budget
+}
+
 func usage() {
 	fmt.Print(`aider-ralph - Ralph Wiggum AI Loop Technique for Aider
 
@@ -292,6 +816,50 @@ USAGE:
     aider-ralph --init [PROJECT_NAME]
     aider-ralph [OPTIONS] "<prompt>" [-- AIDER_OPTIONS]
     aider-ralph [OPTIONS] -f PROMPT_FILE [-- AIDER_OPTIONS]
+    aider-ralph notes compact [--notes-file PATH] [-- AIDER_OPTIONS]
+    aider-ralph run [--parallel N] --specs 'GLOB' [OPTIONS] [-- AIDER_OPTIONS]
+    aider-ralph merge [--verify CMD] [--resolve-conflicts] [LOOP...] [-- AIDER_OPTIONS]
+    aider-ralph specs graph [--specs PATH] [--format dot|mermaid]
+    aider-ralph specs lint [--specs PATH] [--strict] [--max-item-length N]
+    aider-ralph report [--session ID] [--markdown PATH] [--html PATH]
+
+COMMANDS:
+    notes compact                Archive the notes file to .ralph/notes-archive/ and
+                                 replace it with an agent-written summary
+
+    run                          Run one loop per specs file matching --specs, each in
+                                 its own git worktree (.ralph/worktrees/<name>) on
+                                 branch ralph/<name>; other options apply to every loop.
+                                 Summary in .ralph/parallel.json
+        --parallel <N>           Loops running at once (default: 2)
+        --no-lint                Start even if "specs lint" finds errors
+
+    merge [LOOP...]              Merge the branches of completed loops from the last
+                                 run (or the named loops) into the current branch,
+                                 honouring "Depends on: a, b" lines in their specs;
+                                 runs the --verify commands after each merge and
+                                 stops at the first conflict or failed verification
+        --resolve-conflicts      Let aider resolve conflicts instead of stopping
+
+    specs graph                  Print the requirement dependency graph declared with
+                                 {#id depends=a,b} annotations
+        --format <FORMAT>        dot (default) or mermaid
+
+    specs lint                   Check the specs for placeholders left from --init,
+                                 duplicates, plain bullets the loop cannot check off,
+                                 empty sections, overly long items, dependency errors
+                                 and missing completion-signal instructions; exits 1
+                                 on errors (run does this before starting its loops)
+        --strict                 Fail on warnings too
+        --max-item-length <N>    Warn about longer requirements (default: 300)
+
+    report                       Burndown and per-requirement iterations, time and
+                                 cost of a run (Markdown on stdout by default)
+        --session <ID>           Session to report on (default: the latest)
+        --markdown <PATH>        Write the Markdown report to PATH
+        --html <PATH>            Write a self-contained HTML report to PATH, with the
+                                 iteration timeline and each iteration's prompt,
+                                 output, notes, diff and verification results
 
 COMMON (RECOMMENDED):
     aider-ralph -s SPECS.md -m 30 -- --model sonnet --yes
@@ -317,9 +885,153 @@ OPTIONS:
                                  default: COMPLETED
                                  Example: <ralph_status>COMPLETED</ralph_status>
 
+    --stdin <MODE>               How aider's stdin is connected (default: null)
+                                 null:    no input; if aider asks an interactive
+                                          question the iteration fails immediately
+                                 inherit: share this terminal so you can answer
+                                 pty:     run aider on a pseudo-terminal (Linux) so it
+                                          keeps colors and progress output; the log and
+                                          tag detection still see plain text
+
+    --pty                        Same as --stdin=pty
+
+    --approve                    After each iteration show the diff stat, notes and
+                                 status, then ask on the terminal to accept, reject
+                                 (revert the changes), edit notes or stop.
+                                 Requires a git repository.
+
+    --confirm-completion         Before stopping on completion, run one audit iteration
+                                 in which a reviewer re-checks every SPECS requirement;
+                                 gaps it finds are appended to the notes. A claim
+                                 with no iteration left to audit exits 4
+
+    --task-mode <MODE>           Who picks each iteration's requirement (default: self)
+                                 self:   the model chooses (PROMPT.md prioritisation)
+                                 driver: the next unchecked SPECS requirement is given
+                                 to the model in a === CURRENT_TASK === section
+
+    --task-max-attempts <N>      In driver mode, skip a requirement after N failed
+                                 iterations (default: 3; tracked in .ralph/tasks.json)
+
+    --verify <COMMAND>           Shell command that must pass after each iteration
+                                 (repeatable); while any fails, completion is not
+                                 accepted and the failure is added to the notes
+
+    --serve <ADDR>               Serve a status API and live dashboard on ADDR
+                                 (e.g. :8080): /api/status, /api/events (SSE),
+                                 Prometheus /metrics and token-protected POST
+                                 /api/pause, /api/resume and /api/stop. Without
+                                 a host only 127.0.0.1 is bound; use
+                                 0.0.0.0:8080 to allow other machines
+
+    --serve-token <TOKEN>        Token for the control endpoints (default:
+                                 $RALPH_SERVE_TOKEN, else a random token that is
+                                 printed at startup)
+
+    --trace-file <PATH>          Append OTLP/JSON trace spans (session, iterations,
+                                 prompt, agent, verify and git steps) to PATH
+
+    --trace-endpoint <URL>       Post OTLP/JSON trace spans to a collector, e.g.
+                                 http://localhost:4318 (/v1/traces is added to a
+                                 bare address)
+
+    --pre-iteration <COMMAND>    Shell command run before each iteration (repeatable;
+                                 also PRE_ITERATION= in .ralph/config)
+
+    --post-iteration <COMMAND>   Shell command run after each iteration (repeatable;
+                                 also POST_ITERATION= in .ralph/config)
+
+    --on-complete <COMMAND>      Shell command run when the loop completes
+                                 (repeatable; also ON_COMPLETE= in .ralph/config)
+
+    --on-failure <COMMAND>       Shell command run when the loop ends without
+                                 completing (repeatable; also ON_FAILURE=)
+
+    --hook-failure <POLICY>      What a failing pre/post-iteration hook does
+                                 (default: abort; also HOOK_FAILURE=)
+                                 abort:  stop the loop (exit code 1)
+                                 skip:   skip the iteration (pre) or void its
+                                         status (post); stops after 3 skipped
+                                         iterations in a row
+                                 ignore: log the failure and carry on
+                                 Hooks get RALPH_ITERATION, RALPH_SESSION,
+                                 RALPH_STATUS, RALPH_NOTES_FILE, ... in their
+                                 environment
+
+    --inject-max-bytes <N>       Cap on the output of a hook or --verify command
+                                 prefixed with [inject] or [inject=NAME] that is
+                                 added to the next prompt as a NAME section
+                                 (default: 8000, 0 = unlimited)
+
+    --coverage-cmd <COMMAND>     Shell command that runs the tests and writes a
+                                 coverage report, run before the first and after
+                                 every iteration; coverage or passing tests that
+                                 drop fail the iteration (see --coverage-action)
+
+    --coverage-file <PATH>       Coverage report written by --coverage-cmd
+
+    --coverage-format <FORMAT>   auto (default), go (coverprofile), cobertura or lcov
+
+    --coverage-min <PERCENT>     Minimum coverage (default: 0, only guard against drops)
+
+    --coverage-min-tests <N>     Minimum number of passing tests (default: 0)
+
+    --coverage-action <ACTION>   What a coverage or test-count regression does
+                                 fail:   void the iteration's status and add the
+                                         regression to the notes (default)
+                                 revert: also undo the iteration's changes
+
+    --notify-webhook <URL>       POST a JSON notification to URL (retried) when the
+                                 loop completes, reaches max iterations, is
+                                 BLOCKED, keeps failing or stalls (repeatable)
+
+    --notify-cmd <COMMAND>       Run a shell command on the same events (repeatable);
+                                 a Go template, e.g. 'notify-send {{.Event}}'; the
+                                 notification JSON is on stdin
+
+    --notify-failures <N>        Consecutive failed iterations that send
+                                 repeated_failures (default: 3, 0 = never)
+
+    --notify-stall <N>           Consecutive iterations without a newly checked
+                                 requirement that send stalled (default: 5, 0 = never)
+
+    --early-stop                 Stop aider once its output contains a status tag,
+                                 after a grace period, instead of waiting for it
+                                 to exit (saves time and tokens spent afterwards)
+
+    --early-stop-grace <SECONDS> Time aider may keep running after the status tag
+                                 to apply edits and commit (default: 30)
+
+    --on-status <STATUS=ACTION[:EXIT_CODE]>
+                                 Loop action for a status reported in the completion
+                                 tag (repeatable). Actions: continue, stop, pause.
+                                 Defaults: COMPLETED=stop:0 BLOCKED=stop:2
+                                 NEEDS_INPUT=pause IN_PROGRESS=continue
+                                 FAILED=continue (stop exits 3 if so configured)
+
+    --answers-file <PATH>        File a human writes answers into when the agent
+                                 reports NEEDS_INPUT (default: .ralph/answers.md)
+
     --notes-file <PATH>          File to store iteration notes and feed into next iteration
                                  If not set, .ralph/notes.md is used if it exists.
 
+    --compact-notes-every <N>    Compact the notes file every N iterations
+                                 (same as running 'notes compact'; default: never)
+
+    --prompt-budget <N>[t]       Maximum assembled prompt size (default: unlimited)
+                                 Plain N is characters; Nt is estimated tokens.
+                                 Template, conventions and specs are kept intact;
+                                 older notes entries are collapsed into a digest.
+
+    --conventions <PATH>         Project conventions file, re-read each iteration
+                                 If not set, CONVENTIONS.md is used if it exists.
+
+    --conventions-mode <MODE>    How conventions reach aider (default: inject)
+                                 inject: add a === CONVENTIONS === prompt section
+                                 read:   pass the file to aider via --read
+
+    --no-conventions             Do not auto-detect or pass a conventions file
+
     -d, --delay <SECONDS>        Delay between iterations (default: 2)
 
     -l, --log <PATH>             Log all output to file
@@ -414,6 +1126,21 @@ func validate() error {
 		}
 	}
 
+	// Default conventions behavior: if not specified, use CONVENTIONS.md if it exists.
+	if config.NoConventions {
+		config.ConventionsFile = ""
+	} else if config.ConventionsFile == "" {
+		if fileExists(defaultConventionsFile) {
+			config.ConventionsFile = defaultConventionsFile
+		}
+	} else if !fileExists(config.ConventionsFile) {
+		return fmt.Errorf("conventions file not found: %s", config.ConventionsFile)
+	}
+
+	if config.ConventionsMode != "inject" && config.ConventionsMode != "read" {
+		return fmt.Errorf("invalid --conventions-mode: %s (expected inject or read)", config.ConventionsMode)
+	}
+
 	// If no prompt argument and no prompt file and no specs file, show help.
 	// We treat specs as the primary input; prompt template can be defaulted.
 	if config.Prompt == "" && config.PromptFile == "" && config.SpecsFile == "" {
@@ -440,6 +1167,104 @@ func validate() error {
 		}
 	}
 
+	switch config.StdinMode {
+	case stdinNull, stdinInherit:
+	case stdinPTY:
+		if !ptySupported {
+			return fmt.Errorf("--stdin=pty is only supported on Linux")
+		}
+	default:
+		return fmt.Errorf("invalid --stdin: %s (expected null, inherit or pty)", config.StdinMode)
+	}
+
+	if config.SpecsFile != "" && fileExists(config.SpecsFile) {
+		if _, err := loadSpecsGraph(); err != nil {
+			return err
+		}
+	}
+
+	switch config.TaskMode {
+	case taskModeSelf:
+	case taskModeDriver:
+		if config.SpecsFile == "" || !fileExists(config.SpecsFile) {
+			return fmt.Errorf("--task-mode=driver needs a specs file")
+		}
+		if config.TaskMaxAttempts < 1 {
+			return fmt.Errorf("--task-max-attempts must be at least 1")
+		}
+	default:
+		return fmt.Errorf("invalid --task-mode: %s (expected self or driver)", config.TaskMode)
+	}
+
+	if config.EarlyStopGrace < 0 {
+		return fmt.Errorf("--early-stop-grace must not be negative")
+	}
+
+	if err := loadHookConfig(); err != nil {
+		return fmt.Errorf("failed to read %s: %v", configFile, err)
+	}
+	switch config.HookFailure {
+	case "":
+		config.HookFailure = hookFailureAbort
+	case hookFailureAbort, hookFailureSkip, hookFailureIgnore:
+	default:
+		return fmt.Errorf("invalid --hook-failure: %s (expected abort, skip or ignore)", config.HookFailure)
+	}
+
+	for _, option := range []struct {
+		name     string
+		commands []string
+	}{{"--verify", config.Verify}, {"--pre-iteration", config.PreIteration}, {"--post-iteration", config.PostIteration}, {"--on-complete", config.OnComplete}, {"--on-failure", config.OnFailure}} {
+		for _, command := range option.commands {
+			if err := checkInjectPrefix(option.name, command); err != nil {
+				return err
+			}
+		}
+	}
+	if config.InjectMaxBytes < 0 {
+		return fmt.Errorf("--inject-max-bytes must not be negative")
+	}
+
+	if config.CoverageCmd != "" {
+		if config.CoverageFile == "" {
+			return fmt.Errorf("--coverage-cmd needs --coverage-file")
+		}
+		switch config.CoverageFormat {
+		case coverageAuto, coverageGo, coverageCobertura, coverageLCOV:
+		default:
+			return fmt.Errorf("invalid --coverage-format: %s (expected auto, go, cobertura or lcov)", config.CoverageFormat)
+		}
+		switch config.CoverageAction {
+		case coverageActionFail:
+		case coverageActionRevert:
+			if !config.DryRun && !isGitRepo() {
+				return fmt.Errorf("--coverage-action=revert requires a git repository")
+			}
+		default:
+			return fmt.Errorf("invalid --coverage-action: %s (expected fail or revert)", config.CoverageAction)
+		}
+		if config.CoverageMin < 0 || config.CoverageMin > 100 || config.CoverageMinTests < 0 {
+			return fmt.Errorf("--coverage-min must be between 0 and 100 and --coverage-min-tests must not be negative")
+		}
+	}
+
+	for _, command := range config.NotifyCmds {
+		if err := checkNotifyCmd(command); err != nil {
+			return fmt.Errorf("invalid --notify-cmd: %v", err)
+		}
+	}
+	if config.NotifyFailures < 0 || config.NotifyStall < 0 {
+		return fmt.Errorf("--notify-failures and --notify-stall must not be negative")
+	}
+
+	if config.Approve && config.StdinMode == stdinInherit {
+		return fmt.Errorf("--approve needs the terminal for itself and cannot be combined with --stdin=inherit")
+	}
+
+	if config.Approve && !config.DryRun && !isGitRepo() {
+		return fmt.Errorf("--approve requires a git repository so rejected iterations can be reverted")
+	}
+
 	// Warn if user explicitly selected unlimited iterations
 	if config.MaxIterations == 0 {
 		logWarn("Max iterations set to 0 (unlimited). Loop will run indefinitely!")
@@ -482,12 +1307,85 @@ func showConfig() {
 		fmt.Printf("  %sCompletion promise (legacy):%s %s\n", colorCyan, colorReset, config.CompletionPromise)
 	}
 
+	if config.Approve {
+		fmt.Printf("  %sApproval gate:%s after every iteration\n", colorCyan, colorReset)
+	}
+
+	if config.ConfirmCompletion {
+		fmt.Printf("  %sConfirm completion:%s audit iteration before stopping\n", colorCyan, colorReset)
+	}
+
+	if config.TaskMode == taskModeDriver {
+		fmt.Printf("  %sTask mode:%s driver (skip a requirement after %d failed attempts)\n", colorCyan, colorReset, config.TaskMaxAttempts)
+	}
+
+	for _, command := range config.Verify {
+		fmt.Printf("  %sVerify:%s %s\n", colorCyan, colorReset, command)
+	}
+	if config.Serve != "" {
+		fmt.Printf("  %sServe:%s %s\n", colorCyan, colorReset, config.Serve)
+	}
+	for _, hook := range []struct {
+		name     string
+		commands []string
+	}{{hookPreIteration, config.PreIteration}, {hookPostIteration, config.PostIteration}, {hookOnComplete, config.OnComplete}, {hookOnFailure, config.OnFailure}} {
+		for _, command := range hook.commands {
+			fmt.Printf("  %sHook %s:%s %s\n", colorCyan, hook.name, colorReset, command)
+		}
+	}
+	if len(config.PreIteration) > 0 || len(config.PostIteration) > 0 {
+		fmt.Printf("  %sHook failure:%s %s\n", colorCyan, colorReset, config.HookFailure)
+	}
+	if config.CoverageCmd != "" {
+		fmt.Printf("  %sCoverage guard:%s %s → %s (min %g%%, %d tests; action: %s)\n", colorCyan, colorReset, config.CoverageCmd, config.CoverageFile, config.CoverageMin, config.CoverageMinTests, config.CoverageAction)
+	}
+	for _, url := range config.NotifyWebhooks {
+		fmt.Printf("  %sNotify webhook:%s %s\n", colorCyan, colorReset, url)
+	}
+	for _, command := range config.NotifyCmds {
+		fmt.Printf("  %sNotify command:%s %s\n", colorCyan, colorReset, command)
+	}
+	if config.TraceFile != "" {
+		fmt.Printf("  %sTrace file:%s %s\n", colorCyan, colorReset, config.TraceFile)
+	}
+	if config.TraceEndpoint != "" {
+		fmt.Printf("  %sTrace endpoint:%s %s\n", colorCyan, colorReset, traceEndpointURL(config.TraceEndpoint))
+	}
+
+	if config.EarlyStop {
+		fmt.Printf("  %sEarly stop:%s %ds after the status tag\n", colorCyan, colorReset, config.EarlyStopGrace)
+	}
+
+	var actions []string
+	for _, status := range knownStatuses {
+		sa := actionForStatus(status)
+		if sa.Action == actionStop {
+			actions = append(actions, fmt.Sprintf("%s=%s:%d", status, sa.Action, sa.ExitCode))
+		} else {
+			actions = append(actions, fmt.Sprintf("%s=%s", status, sa.Action))
+		}
+	}
+	fmt.Printf("  %sStatus actions:%s %s\n", colorCyan, colorReset, strings.Join(actions, " "))
+
 	fmt.Printf("  %sTimeout:%s %ds\n", colorCyan, colorReset, config.Timeout)
+	fmt.Printf("  %sAider stdin:%s %s\n", colorCyan, colorReset, config.StdinMode)
 
 	if config.NotesFile != "" {
 		fmt.Printf("  %sNotes file:%s %s\n", colorCyan, colorReset, config.NotesFile)
 	}
 
+	if config.CompactNotesEvery > 0 {
+		fmt.Printf("  %sCompact notes:%s every %d iterations\n", colorCyan, colorReset, config.CompactNotesEvery)
+	}
+
+	if config.PromptBudget > 0 {
+		fmt.Printf("  %sPrompt budget:%s %d chars (~%d tokens)\n", colorCyan, colorReset, config.PromptBudget, config.PromptBudget/charsPerToken)
+	}
+
+	if config.ConventionsFile != "" {
+		fmt.Printf("  %sConventions file:%s %s (%s)\n", colorCyan, colorReset, config.ConventionsFile, config.ConventionsMode)
+	}
+
 	if len(config.AiderOpts) > 0 {
 		fmt.Printf("  %sAider options:%s %s\n", colorCyan, colorReset, strings.Join(config.AiderOpts, " "))
 	}
@@ -529,6 +1427,20 @@ func getNotes() (string, error) {
 	return string(data), nil
 }
 
+func getConventions() (string, error) {
+	if config.ConventionsFile == "" {
+		return "", nil
+	}
+	data, err := os.ReadFile(config.ConventionsFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	return string(data), nil
+}
+
 func getPromptTemplate() (string, error) {
 	// Direct prompt overrides everything
 	if config.Prompt != "" {
@@ -558,7 +1470,12 @@ func buildIterationPrompt() (string, error) {
 	if err != nil {
 		return "", err
 	}
+	return buildPrompt(template)
+}
 
+// buildPrompt assembles a prompt from the given template plus the
+// conventions, specs and notes sections.
+func buildPrompt(template string) (string, error) {
 	specs, err := getSpecs()
 	if err != nil {
 		return "", err
@@ -569,9 +1486,34 @@ func buildIterationPrompt() (string, error) {
 		return "", err
 	}
 
+	var notesSummary string
+	if sn, err := loadStructuredNotes(); err != nil {
+		logWarn(fmt.Sprintf("Ignoring structured notes: %v", err))
+	} else {
+		notesSummary = renderStructuredNotes(sn)
+	}
+
+	// Conventions are only injected in "inject" mode; "read" mode hands the
+	// file to aider directly (see runIteration).
+	conventions := ""
+	if config.ConventionsMode == "inject" {
+		conventions, err = getConventions()
+		if err != nil {
+			return "", err
+		}
+	}
+
 	var b strings.Builder
-	b.WriteString(template)
+	b.WriteString(expandCompletionPlaceholders(template))
 	b.WriteString("\n\n")
+	if conventions != "" {
+		b.WriteString("=== CONVENTIONS (reloaded each iteration; follow strictly) ===\n")
+		b.WriteString(conventions)
+		if !strings.HasSuffix(conventions, "\n") {
+			b.WriteString("\n")
+		}
+		b.WriteString("=== END CONVENTIONS ===\n\n")
+	}
 	if config.SpecsFile != "" {
 		b.WriteString("=== SPECS (reloaded each iteration) ===\n")
 		if specs == "" {
@@ -585,6 +1527,53 @@ func buildIterationPrompt() (string, error) {
 		b.WriteString("=== END SPECS ===\n\n")
 	}
 
+	// Dependency annotations decide which requirements may be started
+	if reqs, err := parseSpecs(specs); err == nil {
+		if g, err := buildSpecsGraph(reqs); err != nil {
+			logWarn(fmt.Sprintf("Ignoring requirement dependencies: %v", err))
+		} else if g.hasDependencies() {
+			b.WriteString("=== REQUIREMENT_STATUS (from dependency annotations) ===\n")
+			b.WriteString(renderRequirementStatus(g))
+			b.WriteString("=== END REQUIREMENT_STATUS ===\n\n")
+		}
+	}
+
+	if currentTask != nil {
+		b.WriteString("=== CURRENT_TASK (selected by the loop driver) ===\n")
+		b.WriteString(renderCurrentTask(currentTask.Req))
+		b.WriteString("=== END CURRENT_TASK ===\n\n")
+	}
+
+	// Output of [inject] hook and verify commands, e.g. lint findings
+	b.WriteString(renderInjections())
+
+	if answers, err := getHumanAnswers(); err != nil {
+		return "", err
+	} else if answers != "" {
+		b.WriteString("=== HUMAN_INPUT (answers from a human operator; takes priority) ===\n")
+		if q := pendingQuestion(); q != "" {
+			b.WriteString("Question:\n" + q + "\n\nAnswer:\n")
+		}
+		b.WriteString(answers + "\n")
+		b.WriteString("=== END HUMAN_INPUT ===\n\n")
+	}
+
+	if notesSummary != "" {
+		b.WriteString("=== NOTES_SUMMARY (open blockers, decisions, next steps) ===\n")
+		b.WriteString(notesSummary)
+		b.WriteString("=== END NOTES_SUMMARY ===\n\n")
+	}
+
+	// Under a prompt budget the raw notes get what is left of it, and no
+	// more than summaryNotesBudget next to a notes summary
+	if notes != "" && config.PromptBudget > 0 {
+		avail := config.PromptBudget - b.Len()
+		if notesSummary != "" && avail > summaryNotesBudget {
+			avail = summaryNotesBudget
+		}
+		notes = budgetNotes(notes, avail)
+	}
+
 	if notes != "" {
 		b.WriteString("=== PRIOR_NOTES (carry forward) ===\n")
 		b.WriteString(notes)
@@ -597,6 +1586,27 @@ func buildIterationPrompt() (string, error) {
 	return b.String(), nil
 }
 
+// budgetNotes fits the notes into the room left by the rest of the prompt
+// and logs what had to be collapsed or dropped.
+func budgetNotes(notes string, avail int) string {
+	const wrapper = len("=== PRIOR_NOTES (carry forward) ===\n") + len("=== END PRIOR_NOTES ===\n\n") + 1
+	if avail-wrapper <= 0 {
+		logWarn(fmt.Sprintf("Prompt template, conventions and specs already use the %d char prompt budget; prior notes omitted", config.PromptBudget))
+		return ""
+	}
+
+	fitted, report := fitNotesToBudget(notes, avail-wrapper)
+	if report.FinalChars < report.OriginalChars {
+		msg := fmt.Sprintf("Notes reduced from %d to %d chars (%d entries in full, %d collapsed to digest, %d dropped)",
+			report.OriginalChars, report.FinalChars, report.Full, report.Digested, report.Dropped)
+		if report.Truncated {
+			msg += "; newest entry truncated"
+		}
+		logWarn(msg)
+	}
+	return fitted
+}
+
 func checkCompletion(output string) bool {
 	// Prefer tag-based completion (low collision)
 	if config.CompletionTag != "" && config.CompletionValue != "" {
@@ -636,6 +1646,11 @@ func extractRalphNotes(output string) string {
 }
 
 func appendNotes(iteration int, notes string) error {
+	return appendNotesEntry(fmt.Sprintf("Iteration %d", iteration), notes)
+}
+
+// appendNotesEntry appends a "## <title> (<timestamp>)" section to the notes file.
+func appendNotesEntry(title string, notes string) error {
 	if config.NotesFile == "" || strings.TrimSpace(notes) == "" {
 		return nil
 	}
@@ -653,7 +1668,7 @@ func appendNotes(iteration int, notes string) error {
 	}
 	defer f.Close()
 
-	header := fmt.Sprintf("\n## Iteration %d (%s)\n\n", iteration, timestamp())
+	header := fmt.Sprintf("\n## %s (%s)\n\n", title, timestamp())
 	if _, err := f.WriteString(header); err != nil {
 		return err
 	}
@@ -668,13 +1683,64 @@ func appendNotes(iteration int, notes string) error {
 	return nil
 }
 
-func runIteration(iteration int, logWriter io.Writer) bool {
+func runIteration(iteration int, logWriter io.Writer) (rec iterationRecord) {
+	rec = iterationRecord{Iteration: iteration, StartedAt: time.Now()}
+	defer func() {
+		rec.EndedAt = time.Now()
+		rec.DurationSeconds = rec.EndedAt.Sub(rec.StartedAt).Seconds()
+	}()
+
 	logIter(fmt.Sprintf("Iteration %d starting...", iteration))
+	session.emit(sessionEvent{Type: eventIterationStarted, Iteration: iteration})
+
+	if g, err := loadSpecsGraph(); err == nil && g.hasDependencies() {
+		done, ready, blocked := g.counts()
+		logInfo(fmt.Sprintf("Requirements: %d/%d done, %d ready, %d blocked", done, len(g.Reqs), ready, blocked))
+	}
+
+	// In driver mode, we choose the requirement rather than the model
+	if config.TaskMode == taskModeDriver {
+		task, exhausted, err := selectTask()
+		if err != nil {
+			logError(fmt.Sprintf("Failed to select a requirement: %v", err))
+			rec.Outcome = "error"
+			return rec
+		}
+		if exhausted {
+			logError("Every remaining requirement has been skipped after repeated failures")
+			rec.Outcome = "tasks_exhausted"
+			return rec
+		}
 
+		currentTask = &taskAssignment{Req: task}
+		defer func() { currentTask = nil }()
+		if task != nil {
+			rec.Task = task.Text
+			logInfo(fmt.Sprintf("Requirement for this iteration: %s", task.Text))
+			defer func() {
+				if rec.Outcome != "error" && rec.Outcome != "dry_run" {
+					recordTaskAttempt(task, rec)
+				}
+			}()
+		} else {
+			logInfo("Every requirement is checked; asking the agent to confirm completion")
+		}
+	}
+
+	promptSpan := startSpan("prompt")
 	prompt, err := buildIterationPrompt()
+	promptSpan.set("ralph.prompt_bytes", len(prompt))
+	promptSpan.end()
 	if err != nil {
 		logError(fmt.Sprintf("Failed to build prompt: %v", err))
-		return false
+		rec.Outcome = "error"
+		return rec
+	}
+	session.saveArtifact(iteration, artifactPrompt, prompt)
+
+	answers, err := getHumanAnswers()
+	if err != nil {
+		logWarn(fmt.Sprintf("Failed to read answers file: %v", err))
 	}
 
 	if config.Verbose {
@@ -692,6 +1758,9 @@ func runIteration(iteration int, logWriter io.Writer) bool {
 
 	// Build aider command
 	args := []string{"--message", prompt, "--yes"}
+	if config.ConventionsFile != "" && config.ConventionsMode == "read" {
+		args = append(args, "--read", config.ConventionsFile)
+	}
 	args = append(args, config.AiderOpts...)
 
 	if config.Verbose {
@@ -700,54 +1769,45 @@ func runIteration(iteration int, logWriter io.Writer) bool {
 
 	if config.DryRun {
 		logInfo(fmt.Sprintf("[DRY RUN] Would execute: aider %s", strings.Join(args, " ")))
-		return false // Continue loop in dry run
+		rec.Outcome = "dry_run"
+		return rec // Continue loop in dry run
 	}
 
-	// Create context with timeout
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(config.Timeout)*time.Second)
-	defer cancel()
-
-	// Run aider with context
-	cmd := exec.CommandContext(ctx, "aider", args...)
-	cmd.Stdin = os.Stdin
-
-	// Capture output while also displaying it
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		logError(fmt.Sprintf("Failed to create stdout pipe: %v", err))
-		return false
+	result := runAgent(args, logWriter)
+	if result.Err != nil {
+		rec.Outcome = "error"
+		return rec
 	}
-
-	cmd.Stderr = cmd.Stdout // Combine stderr with stdout
-
-	if err := cmd.Start(); err != nil {
-		logError(fmt.Sprintf("Failed to start aider: %v", err))
-		return false
+	output := result.Output
+	rec.AgentExitCode = &result.ExitCode
+	session.saveArtifact(iteration, artifactOutput, output)
+	rec.Model = iterationModel(output)
+	rec.TokensSent, rec.TokensReceived, rec.Cost = parseAiderUsage(output)
+	rec.Termination = result.Termination
+	if result.ReadErr != nil {
+		rec.ReadError = result.ReadErr.Error()
 	}
-
-	// Read output line by line
-	var outputBuilder strings.Builder
-	scanner := bufio.NewScanner(stdout)
-	scanner.Buffer(make([]byte, 1024*1024), 1024*1024) // 1MB buffer
-
-	for scanner.Scan() {
-		line := scanner.Text()
-		fmt.Println(line)
-		outputBuilder.WriteString(line)
-		outputBuilder.WriteString("\n")
-
-		if logWriter != nil {
-			fmt.Fprintln(logWriter, line)
-		}
+	if result.Termination == terminationStopped {
+		logInfo(fmt.Sprintf("aider was stopped %ds after reporting its status", config.EarlyStopGrace))
 	}
 
-	_ = cmd.Wait()
-	output := outputBuilder.String()
+	// Answers were delivered to the agent; record them and don't repeat them
+	consumeHumanAnswers(iteration, answers)
 
 	// Check if killed due to timeout
-	if ctx.Err() == context.DeadlineExceeded {
+	if result.TimedOut {
 		logWarn(fmt.Sprintf("Iteration timed out after %ds - aider was killed", config.Timeout))
-		return false
+		rec.Outcome = "timeout"
+		return rec
+	}
+
+	// Check if killed because aider wanted an answer nobody can give
+	if result.Prompt != "" {
+		logError(fmt.Sprintf("aider asked an interactive question (%s) and was stopped: %q", result.PromptKind, result.Prompt))
+		logWarn("Check the aider options/configuration, or run with --stdin=inherit to answer such questions yourself")
+		rec.Outcome = "interactive_prompt"
+		rec.StatusReason = result.Prompt
+		return rec
 	}
 
 	// Log iteration to file
@@ -757,30 +1817,99 @@ func runIteration(iteration int, logWriter io.Writer) bool {
 
 	// Extract and persist notes for next iteration
 	notes := extractRalphNotes(output)
+	session.saveArtifact(iteration, artifactNotes, notes)
 	if notes != "" {
 		if err := appendNotes(iteration, notes); err != nil {
 			logWarn(fmt.Sprintf("Failed to append notes: %v", err))
 		} else if config.Verbose {
 			logInfo("Appended <ralph_notes> to notes file for next iteration")
 		}
+		if err := updateStructuredNotes(iteration, notes); err != nil {
+			logWarn(fmt.Sprintf("Failed to update structured notes: %v", err))
+		}
 	}
 
-	// Check for completion
-	if checkCompletion(output) {
+	// Check for completion or another reported status
+	rec.Status, rec.StatusReason = result.status()
+	rec.Outcome = statusOutcome(rec.Status)
+
+	// The project's own checks overrule a claim of completion
+	if len(config.Verify) > 0 {
+		var passed bool
+		verifySpan := startSpan("verify")
+		rec.Verify, passed = runVerifyCommands(logWriter)
+		verifySpan.set("ralph.verify.passed", passed)
+		if !passed {
+			verifySpan.fail("verification failed")
+		}
+		verifySpan.end()
+		session.saveArtifact(iteration, artifactVerify, verifyArtifact(rec.Verify))
+		for _, v := range rec.Verify {
+			outcome := "passed"
+			if !v.Passed {
+				outcome = "failed"
+			}
+			session.emit(sessionEvent{Type: eventVerify, Iteration: iteration, Outcome: outcome, Message: v.Command})
+		}
+		if !passed {
+			if err := appendNotesEntry(fmt.Sprintf("Iteration %d (verification failed)", iteration), verifyFailureNotes(rec.Verify)); err != nil {
+				logWarn(fmt.Sprintf("Failed to append notes: %v", err))
+			}
+			if rec.Status == statusCompleted {
+				logWarn("Completion claimed but verification failed; the loop continues")
+				rec.Status, rec.StatusReason = "", "completion claimed but verification failed"
+				rec.Outcome = "verify_failed"
+			}
+		}
+	}
+
+	if rec.Status != "" {
+		session.emit(sessionEvent{Type: eventStatus, Iteration: iteration, Status: rec.Status, Message: rec.StatusReason})
+	}
+
+	switch rec.Status {
+	case statusCompleted:
 		if config.CompletionTag != "" && config.CompletionValue != "" {
 			logOK(fmt.Sprintf("Completion tag '<%s>%s</%s>' detected!", config.CompletionTag, config.CompletionValue, config.CompletionTag))
 		} else {
 			logOK(fmt.Sprintf("Completion promise '%s' detected!", config.CompletionPromise))
 		}
-		return true
+	case statusBlocked:
+		logError(fmt.Sprintf("Agent reported %s: %s", rec.Status, rec.StatusReason))
+	case statusNeedsInput, statusFailed:
+		logWarn(fmt.Sprintf("Agent reported %s: %s", rec.Status, rec.StatusReason))
+	case "":
+	default:
+		if config.Verbose {
+			logInfo(fmt.Sprintf("Agent reported %s", rec.Status))
+		}
 	}
 
-	return false
+	return rec
 }
 
-func mainLoop() {
+func mainLoop() int {
 	loopActive = true
 	currentIteration := 0
+	hookSkips := 0 // consecutive iterations skipped by a pre-iteration hook
+	exitCode := 0
+	result := "stopped"
+
+	session = newSession()
+	startTracing(session.ID)
+	session.startProgress()
+	if err := session.save(); err != nil {
+		logWarn(fmt.Sprintf("Failed to save session state: %v", err))
+	}
+	session.emit(sessionEvent{Type: eventSessionStarted, Message: config.SpecsFile})
+
+	if config.Serve != "" {
+		if err := startServer(); err != nil {
+			logError(err.Error())
+			session.finish("error", 1)
+			return 1
+		}
+	}
 
 	// Open log file if specified
 	var logWriter io.Writer
@@ -795,14 +1924,19 @@ func mainLoop() {
 		}
 	}
 
+	// The coverage guard compares the first iteration with this baseline
+	startCoverageGuard(logWriter)
+
 	for loopActive {
 		currentIteration++
 
 		// Check max iterations
 		if config.MaxIterations > 0 && currentIteration > config.MaxIterations {
 			logWarn(fmt.Sprintf("Max iterations (%d) reached", config.MaxIterations))
+			result = "max_iterations"
 			break
 		}
+		control.setIteration(currentIteration)
 
 		// Show progress
 		fmt.Println()
@@ -819,10 +1953,176 @@ func mainLoop() {
 			fmt.Fprintf(logWriter, "=== Iteration %d ===\n", currentIteration)
 		}
 
-		// Run iteration
-		if runIteration(currentIteration, logWriter) {
-			logOK(fmt.Sprintf("Loop completed successfully after %d iteration(s)!", currentIteration))
-			loopActive = false
+		beginIterationSpan(currentIteration)
+
+		// Set-up hooks run before the snapshots, so their changes are not
+		// counted as the iteration's
+		preHooks, hookAction := runPreIterationHooks(currentIteration, logWriter)
+		if hookAction == hookFailureAbort {
+			session.record(hookFailedRecord(currentIteration, preHooks))
+			logError("Loop stopped: a pre-iteration hook failed")
+			result = "hook_failed"
+			exitCode = 1
+			break
+		}
+		if hookAction == hookFailureSkip {
+			hookSkips++
+		} else {
+			hookSkips = 0
+		}
+		if hookSkips > maxHookSkips {
+			session.record(hookFailedRecord(currentIteration, preHooks))
+			logError(fmt.Sprintf("Loop stopped: a pre-iteration hook failed %d times in a row", hookSkips))
+			result = "hook_failed"
+			exitCode = 1
+			break
+		}
+
+		var snap *workspaceSnapshot
+		if config.Approve && !config.DryRun && hookAction == "" {
+			var err error
+			if snap, err = takeSnapshot(); err != nil {
+				logError(fmt.Sprintf("Failed to snapshot work tree for approval: %v", err))
+				result = "error"
+				exitCode = 1
+				break
+			}
+		}
+
+		// The iteration's diff is kept with its artifacts
+		diffSnap := snap
+		if diffSnap == nil && !config.DryRun && hookAction == "" && isGitRepo() {
+			diffSnap, _ = takeSnapshot()
+		}
+
+		// Run iteration, unless a failing set-up hook skips it
+		var rec iterationRecord
+		if hookAction == hookFailureSkip {
+			logWarn(fmt.Sprintf("Skipping iteration %d: a pre-iteration hook failed", currentIteration))
+			rec = hookFailedRecord(currentIteration, preHooks)
+		} else {
+			rec = runIteration(currentIteration, logWriter)
+			rec.Hooks = append(preHooks, rec.Hooks...)
+			session.saveArtifact(currentIteration, artifactDiff, iterationDiff(diffSnap))
+			if config.CoverageCmd != "" && rec.AgentExitCode != nil {
+				guardCoverage(&rec, diffSnap, logWriter)
+			}
+			if runPostIterationHooks(&rec, logWriter) == hookFailureAbort {
+				session.saveArtifact(currentIteration, artifactHooks, hooksArtifact(rec.Hooks))
+				session.record(rec)
+				logError("Loop stopped: a post-iteration hook failed")
+				result = "hook_failed"
+				exitCode = 1
+				break
+			}
+		}
+		session.saveArtifact(currentIteration, artifactHooks, hooksArtifact(rec.Hooks))
+
+		if rec.Outcome == "tasks_exhausted" {
+			session.record(rec)
+			fmt.Print("\a")
+			logError(fmt.Sprintf("Loop stopped: no requirement left to work on (see %s)", tasksFile))
+			result = rec.Outcome
+			exitCode = exitBlocked
+			break
+		}
+
+		// Let a human accept or reject the iteration before acting on it
+		if snap != nil {
+			approval := startSpan("approval")
+			decision := approvalGate(rec, snap)
+			approval.set("ralph.decision", decision)
+			approval.end()
+			switch decision {
+			case approveReject:
+				rec.Outcome = "rejected"
+			case approveStop:
+				session.record(rec)
+				logWarn(fmt.Sprintf("Loop stopped by approver after %d iteration(s)", currentIteration))
+				result = "stopped"
+				loopActive = false
+			}
+			if !loopActive {
+				break
+			}
+		}
+
+		session.record(rec)
+		notifications.observe(rec)
+
+		// Don't take the agent's word for completion if asked to audit it
+		if rec.Outcome != "rejected" && rec.Status == statusCompleted && config.ConfirmCompletion && actionForStatus(rec.Status).Action == actionStop {
+			// The audit is an iteration too, so it must fit in the limit
+			if config.MaxIterations > 0 && currentIteration >= config.MaxIterations {
+				logError(fmt.Sprintf("Max iterations (%d) reached; completion was claimed but could not be audited", config.MaxIterations))
+				result = "unaudited_completion"
+				exitCode = exitUnaudited
+				break
+			}
+			currentIteration++
+			fmt.Println()
+			fmt.Printf("%s═══════════════════════════════════════════════════════════%s\n", colorBold, colorReset)
+			fmt.Printf("%s  COMPLETION AUDIT (iteration %d)%s\n", colorPurple, currentIteration, colorReset)
+			fmt.Printf("%s═══════════════════════════════════════════════════════════%s\n", colorBold, colorReset)
+			fmt.Println()
+			if logWriter != nil {
+				fmt.Fprintf(logWriter, "=== Iteration %d (completion audit) ===\n", currentIteration)
+			}
+
+			beginIterationSpan(currentIteration)
+			audit := runAudit(currentIteration, logWriter)
+			session.record(audit)
+			if audit.Status != statusCompleted {
+				// Gaps are in the notes; keep looping
+				rec = audit
+			}
+		}
+
+		// A rejected iteration's status is void; its changes were reverted
+		if rec.Status != "" && rec.Outcome != "rejected" {
+			action := actionForStatus(rec.Status)
+			switch action.Action {
+			case actionStop:
+				if rec.Status == statusCompleted {
+					logOK(fmt.Sprintf("Loop completed successfully after %d iteration(s)!", currentIteration))
+				} else {
+					fmt.Print("\a")
+					logError(fmt.Sprintf("Loop stopped: agent reported %s after %d iteration(s)", rec.Status, currentIteration))
+				}
+				result = rec.Outcome
+				exitCode = action.ExitCode
+				loopActive = false
+			case actionPause:
+				if !waitForHumanInput(rec.StatusReason) {
+					result = "interrupted"
+					if control.stopRequested() {
+						logWarn(fmt.Sprintf("Loop stopped via the HTTP API after %d iteration(s)", currentIteration))
+						result = "stopped"
+						exitCode = 130
+					}
+					loopActive = false
+				}
+			}
+			if !loopActive {
+				break
+			}
+		}
+
+		// Periodically condense the notes so they stay useful
+		if config.CompactNotesEvery > 0 && currentIteration%config.CompactNotesEvery == 0 && !config.DryRun {
+			if logWriter != nil {
+				fmt.Fprintf(logWriter, "=== Notes compaction after iteration %d ===\n", currentIteration)
+			}
+			if err := compactNotes(logWriter); err != nil {
+				logWarn(fmt.Sprintf("Notes compaction failed: %v", err))
+			}
+		}
+
+		// A stop requested through the HTTP API (--serve) ends the loop here
+		if loopActive && control.stopRequested() {
+			logWarn(fmt.Sprintf("Loop stopped via the HTTP API after %d iteration(s)", currentIteration))
+			result = "stopped"
+			exitCode = 130
 			break
 		}
 
@@ -831,14 +2131,30 @@ func mainLoop() {
 			logInfo(fmt.Sprintf("Waiting %ds before next iteration...", config.Delay))
 			time.Sleep(time.Duration(config.Delay) * time.Second)
 		}
+
+		if loopActive && !control.waitWhilePaused() {
+			logWarn(fmt.Sprintf("Loop stopped via the HTTP API after %d iteration(s)", currentIteration))
+			result = "stopped"
+			exitCode = 130
+			break
+		}
 	}
 
 	fmt.Println()
 	logInfo(fmt.Sprintf("Ralph loop finished. Total iterations: %d", currentIteration))
 
+	runLoopEndHooks(result, exitCode, currentIteration, logWriter)
+	notifyResult(result, currentIteration)
+	session.finish(result, exitCode)
+
 	if config.LogFile != "" {
 		fmt.Printf("\n%s📋 Log saved to: %s%s\n", colorCyan, config.LogFile, colorReset)
 	}
+	if !config.DryRun {
+		fmt.Printf("%s📋 Session state: %s%s\n", colorCyan, filepath.Join(session.dir(), "state.json"), colorReset)
+	}
+
+	return exitCode
 }
 
 func setupSignalHandler() {
@@ -850,6 +2166,9 @@ func setupSignalHandler() {
 		fmt.Println()
 		logWarn("Interrupted by user (Ctrl+C)")
 		loopActive = false
+		if session != nil {
+			session.finish("interrupted", 130)
+		}
 		os.Exit(130)
 	}()
 }
@@ -867,11 +2186,9 @@ func initProject() {
 	}
 
 	specsFile := defaultSpecsFile
-	ralphDir := ".ralph"
-	configFile := filepath.Join(ralphDir, "config")
 	logsDir := filepath.Join(ralphDir, "logs")
 	notesFile := filepath.Join(ralphDir, "notes.md")
-	conventionsFile := "CONVENTIONS.md"
+	conventionsFile := defaultConventionsFile
 
 	fmt.Printf("%sInitializing aider-ralph project: %s%s%s\n\n", colorCyan, colorBold, projectName, colorReset)
 
@@ -984,6 +2301,13 @@ NOTES_FILE=.ralph/notes.md
 
 # Aider options (space-separated)
 # AIDER_EXTRA_OPTS=--yes
+
+# Hooks (read by aider-ralph; one command per line, repeatable)
+# PRE_ITERATION=docker compose up -d db
+# POST_ITERATION=docker compose stop db
+# ON_COMPLETE=notify-send "aider-ralph completed"
+# ON_FAILURE=notify-send "aider-ralph stopped: $RALPH_RESULT"
+# HOOK_FAILURE=abort
 `
 		if err := os.WriteFile(configFile, []byte(configContent), 0644); err != nil {
 			logError(fmt.Sprintf("Failed to create %s: %v", configFile, err))
@@ -992,16 +2316,33 @@ NOTES_FILE=.ralph/notes.md
 		}
 	}
 
-	// Add to .gitignore if it exists
-	gitignorePath := ".gitignore"
-	if _, err := os.Stat(gitignorePath); err == nil {
-		content, err := os.ReadFile(gitignorePath)
-		if err == nil && !strings.Contains(string(content), ".ralph/logs") {
-			f, err := os.OpenFile(gitignorePath, os.O_APPEND|os.O_WRONLY, 0644)
+	// Add aider-ralph's working files to .gitignore if it exists
+	gitignoreEntries := []struct{ pattern, comment string }{
+		{".ralph/logs/", "aider-ralph logs"},
+		{".ralph/sessions/", "aider-ralph session state"},
+		{".ralph/worktrees/", "aider-ralph parallel loop worktrees"},
+	}
+	if content, err := os.ReadFile(".gitignore"); err == nil {
+		var missing strings.Builder
+		var added []string
+		for _, e := range gitignoreEntries {
+			if !strings.Contains(string(content), strings.TrimSuffix(e.pattern, "/")) {
+				fmt.Fprintf(&missing, "\n# %s\n%s\n", e.comment, e.pattern)
+				added = append(added, e.pattern)
+			}
+		}
+		if len(added) > 0 {
+			f, err := os.OpenFile(".gitignore", os.O_APPEND|os.O_WRONLY, 0644)
 			if err == nil {
-				defer f.Close()
-				f.WriteString("\n# aider-ralph logs\n.ralph/logs/\n")
-				fmt.Printf("%s✅ Added .ralph/logs/ to .gitignore%s\n", colorGreen, colorReset)
+				_, err = f.WriteString(missing.String())
+				if cerr := f.Close(); err == nil {
+					err = cerr
+				}
+			}
+			if err != nil {
+				logError(fmt.Sprintf("Failed to update .gitignore: %v", err))
+			} else {
+				fmt.Printf("%s✅ Added %s to .gitignore%s\n", colorGreen, strings.Join(added, ", "), colorReset)
 			}
 		}
 	}
@@ -0,0 +1,400 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// dependsOnRe matches a "Depends on: api, db" line in a loop's specs file,
+// naming loops whose branches must be merged first. This is deliberately
+// not the "{#id depends=a,b}" requirement annotation: that orders
+// requirements within one specs file, while this orders whole loops (named
+// after their specs files), so it is a line of its own rather than a suffix
+// on a checkbox. The list is split the same way, with splitIDs.
+var dependsOnRe = regexp.MustCompile(`(?im)^[ \t]*(?:[-*][ \t]*)?depends[ -]on:[ \t]*(.+?)[ \t]*$`)
+
+// conflictMarkerRe matches the conflict markers git leaves in a file.
+var conflictMarkerRe = regexp.MustCompile(`(?m)^(<<<<<<<|>>>>>>>)( |$)`)
+
+// Merge results reported per loop branch.
+const (
+	mergeMerged       = "merged"
+	mergeResolved     = "merged (conflicts resolved)"
+	mergeUpToDate     = "already merged"
+	mergeConflict     = "conflict"
+	mergeFailed       = "failed"
+	mergeVerifyFailed = "verify failed"
+	mergeSkipped      = "skipped"
+	mergeNotAttempted = "not attempted"
+)
+
+// mergeItem is one loop branch considered by "merge".
+type mergeItem struct {
+	loop      *parallelLoop
+	dependsOn []string
+	result    string
+	detail    string
+}
+
+// runMergeCommand implements "aider-ralph merge": merge the branches of
+// completed parallel loops into the current branch, dependencies first,
+// verifying after each merge. It stops at the first merge that conflicts
+// (unless aider resolves it) or fails verification, leaving the base branch
+// as it was before that merge.
+func runMergeCommand(args []string) int {
+	if !isGitRepo() {
+		logError("merge needs a git repository")
+		return 1
+	}
+	if dirty, err := gitOutput("status", "--porcelain", "--untracked-files=no"); err != nil || dirty != "" {
+		logError("Working tree has uncommitted changes; commit or stash them before merging")
+		return 1
+	}
+	if _, err := gitOutput("rev-parse", "-q", "--verify", "MERGE_HEAD"); err == nil {
+		logError("A merge is already in progress")
+		return 1
+	}
+	if config.ResolveConflicts {
+		if _, err := exec.LookPath("aider"); err != nil {
+			logError("aider is not installed. Install with: pip install aider-chat")
+			return 1
+		}
+	}
+
+	data, err := os.ReadFile(parallelSummaryFile)
+	if err != nil {
+		logError(fmt.Sprintf("Cannot read %s (run 'aider-ralph run' first): %v", parallelSummaryFile, err))
+		return 1
+	}
+	var run parallelRun
+	if err := json.Unmarshal(data, &run); err != nil {
+		logError(fmt.Sprintf("Invalid %s: %v", parallelSummaryFile, err))
+		return 1
+	}
+
+	base, err := gitOutput("rev-parse", "--abbrev-ref", "HEAD")
+	if err != nil {
+		logError(err.Error())
+		return 1
+	}
+	if strings.HasPrefix(base, "ralph/") {
+		logError(fmt.Sprintf("Currently on loop branch %s; check out the base branch to merge into", base))
+		return 1
+	}
+
+	items, err := planMerge(run.Loops, args)
+	if err != nil {
+		logError(err.Error())
+		return 1
+	}
+
+	logInfo(fmt.Sprintf("Merging loop branches into %s", base))
+	merged := map[string]bool{}
+	stopped := false
+	for _, item := range items {
+		if item.result != "" {
+			continue
+		}
+		if stopped {
+			item.result = mergeNotAttempted
+			continue
+		}
+		if missing := unmergedDependencies(item, merged); len(missing) > 0 {
+			item.result = mergeSkipped
+			item.detail = "depends on unmerged " + strings.Join(missing, ", ")
+			continue
+		}
+
+		mergeBranch(item, base)
+		switch item.result {
+		case mergeMerged, mergeResolved, mergeUpToDate:
+			merged[item.loop.Name] = true
+		default:
+			stopped = true
+		}
+	}
+
+	printMergeReport(items, base)
+	if stopped {
+		return 1
+	}
+	return 0
+}
+
+// planMerge selects the loops to merge (completed ones, or those named in
+// names) and orders them so every loop comes after the loops it depends on.
+func planMerge(loops []*parallelLoop, names []string) ([]*mergeItem, error) {
+	wanted := map[string]bool{}
+	for _, name := range names {
+		wanted[name] = true
+	}
+
+	byName := map[string]*mergeItem{}
+	var items []*mergeItem
+	for _, loop := range loops {
+		item := &mergeItem{loop: loop}
+		switch {
+		case len(wanted) > 0 && !wanted[loop.Name]:
+			continue
+		case len(wanted) == 0 && loop.Result != "completed":
+			item.result = mergeSkipped
+			item.detail = "loop result: " + loop.Result
+		}
+		delete(wanted, loop.Name)
+		byName[loop.Name] = item
+		items = append(items, item)
+	}
+	for name := range wanted {
+		return nil, fmt.Errorf("no loop named %q in %s", name, parallelSummaryFile)
+	}
+
+	known := map[string]bool{}
+	for _, loop := range loops {
+		known[loop.Name] = true
+	}
+	for _, item := range items {
+		specs, err := gitOutput("show", item.loop.Branch+":./"+item.loop.Specs)
+		if err != nil {
+			continue
+		}
+		for _, m := range dependsOnRe.FindAllStringSubmatch(specs, -1) {
+			for _, dep := range splitIDs(m[1]) {
+				if dep == item.loop.Name {
+					continue
+				}
+				if !known[dep] {
+					logWarn(fmt.Sprintf("%s depends on %q, which is not a loop of the last run; ignoring", item.loop.Specs, dep))
+					continue
+				}
+				item.dependsOn = append(item.dependsOn, dep)
+			}
+		}
+	}
+
+	return orderMergeItems(items, byName)
+}
+
+// orderMergeItems sorts items topologically by dependsOn (ties by name).
+// Dependencies on loops outside the run are ignored here.
+func orderMergeItems(items []*mergeItem, byName map[string]*mergeItem) ([]*mergeItem, error) {
+	indegree := map[string]int{}
+	dependents := map[string][]string{}
+	for _, item := range items {
+		indegree[item.loop.Name] = 0
+	}
+	for _, item := range items {
+		for _, dep := range item.dependsOn {
+			if _, ok := byName[dep]; !ok {
+				continue
+			}
+			indegree[item.loop.Name]++
+			dependents[dep] = append(dependents[dep], item.loop.Name)
+		}
+	}
+
+	var ready []string
+	for name, n := range indegree {
+		if n == 0 {
+			ready = append(ready, name)
+		}
+	}
+
+	var ordered []*mergeItem
+	for len(ready) > 0 {
+		sort.Strings(ready)
+		name := ready[0]
+		ready = ready[1:]
+		ordered = append(ordered, byName[name])
+		for _, next := range dependents[name] {
+			indegree[next]--
+			if indegree[next] == 0 {
+				ready = append(ready, next)
+			}
+		}
+	}
+
+	if len(ordered) < len(items) {
+		var cycle []string
+		for name, n := range indegree {
+			if n > 0 {
+				cycle = append(cycle, name)
+			}
+		}
+		sort.Strings(cycle)
+		return nil, fmt.Errorf("dependency cycle between loops: %s", strings.Join(cycle, ", "))
+	}
+	return ordered, nil
+}
+
+// unmergedDependencies lists the dependencies of item that have not been
+// merged in this run. Dependencies that are already part of HEAD count as
+// merged.
+func unmergedDependencies(item *mergeItem, merged map[string]bool) []string {
+	var missing []string
+	for _, dep := range item.dependsOn {
+		if merged[dep] {
+			continue
+		}
+		if _, err := gitOutput("merge-base", "--is-ancestor", "ralph/"+dep, "HEAD"); err == nil {
+			continue
+		}
+		missing = append(missing, dep)
+	}
+	return missing
+}
+
+// mergeBranch merges one loop branch into the current branch and runs the
+// verify commands, setting item.result. On failure HEAD is put back where
+// it was.
+func mergeBranch(item *mergeItem, base string) {
+	branch := item.loop.Branch
+	before, err := gitOutput("rev-parse", "HEAD")
+	if err != nil {
+		item.result, item.detail = mergeFailed, err.Error()
+		return
+	}
+
+	logInfo(fmt.Sprintf("Merging %s into %s", branch, base))
+	out, mergeErr := gitOutput("merge", "--no-ff", "--no-edit", "-m", fmt.Sprintf("Merge %s (aider-ralph loop %s)", branch, item.loop.Name), branch)
+	if mergeErr == nil && strings.Contains(out, "Already up to date") {
+		item.result = mergeUpToDate
+		logInfo(fmt.Sprintf("%s is already merged", branch))
+		return
+	}
+
+	item.result = mergeMerged
+	if mergeErr != nil {
+		conflicted, _ := gitOutput("diff", "--name-only", "--diff-filter=U")
+		if conflicted == "" {
+			// Not a conflict: the merge itself could not run
+			item.result, item.detail = mergeFailed, mergeErr.Error()
+			_, _ = gitOutput("merge", "--abort")
+			return
+		}
+		files := strings.Split(conflicted, "\n")
+		logWarn(fmt.Sprintf("Merge of %s conflicts in %d file(s): %s", branch, len(files), strings.Join(files, ", ")))
+
+		if !config.ResolveConflicts {
+			_, _ = gitOutput("merge", "--abort")
+			item.result, item.detail = mergeConflict, strings.Join(files, ", ")
+			return
+		}
+		top, err := gitOutput("rev-parse", "--show-toplevel")
+		if err == nil {
+			err = resolveConflicts(item, base, top, files)
+		}
+		if err != nil {
+			logError(fmt.Sprintf("Conflicts in %s not resolved: %v", branch, err))
+			_, _ = gitOutput("merge", "--abort")
+			item.result, item.detail = mergeConflict, fmt.Sprintf("%s (%v)", strings.Join(files, ", "), err)
+			return
+		}
+		item.result = mergeResolved
+	}
+
+	if len(config.Verify) > 0 {
+		results, passed := runVerifyCommands(nil)
+		if !passed {
+			var failed []string
+			for _, r := range results {
+				if !r.Passed {
+					failed = append(failed, r.Command)
+				}
+			}
+			if _, err := gitOutput("reset", "--hard", before); err != nil {
+				logError(fmt.Sprintf("Failed to undo the merge of %s: %v", branch, err))
+			}
+			item.result, item.detail = mergeVerifyFailed, strings.Join(failed, "; ")
+			return
+		}
+	}
+	logOK(fmt.Sprintf("Merged %s", branch))
+}
+
+// resolveConflicts runs one aider iteration to resolve the conflicted files
+// (relative to the repository root top) of an in-progress merge, then
+// concludes the merge if no markers remain.
+func resolveConflicts(item *mergeItem, base, top string, files []string) error {
+	var paths []string
+	for _, f := range files {
+		paths = append(paths, filepath.Join(top, f))
+	}
+
+	var b strings.Builder
+	b.WriteString(strings.TrimSpace(expandCompletionPlaceholders(embeddedResolveConflictsPrompt)))
+	b.WriteString("\n\n=== MERGE ===\n")
+	fmt.Fprintf(&b, "Base branch: %s\nIncoming branch: %s (loop %s)\nConflicted files:\n", base, item.loop.Branch, item.loop.Name)
+	for _, f := range files {
+		fmt.Fprintf(&b, "- %s\n", f)
+	}
+	b.WriteString("=== END MERGE ===\n\n")
+	if specs, err := gitOutput("show", item.loop.Branch+":./"+item.loop.Specs); err == nil {
+		b.WriteString("=== SPECS (of the incoming branch) ===\n")
+		b.WriteString(specs)
+		b.WriteString("\n=== END SPECS ===\n")
+	}
+	if conventions, err := getConventions(); err == nil && conventions != "" {
+		b.WriteString("\n=== CONVENTIONS ===\n")
+		b.WriteString(conventions)
+		b.WriteString("\n=== END CONVENTIONS ===\n")
+	}
+
+	// The merge is concluded here, not by aider
+	args := []string{"--message", b.String(), "--yes", "--no-auto-commits"}
+	args = append(args, config.AiderOpts...)
+	args = append(args, paths...)
+
+	logIter(fmt.Sprintf("Asking aider to resolve conflicts with %s...", item.loop.Branch))
+	result := runAgent(args, nil)
+	switch {
+	case result.Err != nil:
+		return result.Err
+	case result.TimedOut:
+		return fmt.Errorf("aider timed out after %ds", config.Timeout)
+	case result.Prompt != "":
+		return fmt.Errorf("aider asked an interactive question (%s)", result.PromptKind)
+	}
+	if status, reason := result.status(); status == statusBlocked {
+		return fmt.Errorf("agent reported BLOCKED: %s", reason)
+	}
+
+	for i, path := range paths {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if conflictMarkerRe.Match(content) {
+			return fmt.Errorf("conflict markers remain in %s", files[i])
+		}
+	}
+	if _, err := gitOutput(append([]string{"add", "--"}, paths...)...); err != nil {
+		return err
+	}
+	_, err := gitOutput("commit", "--no-edit")
+	return err
+}
+
+func printMergeReport(items []*mergeItem, base string) {
+	fmt.Println()
+	fmt.Printf("%s🔀 Merge report (into %s)%s\n", colorBold, base, colorReset)
+	for _, item := range items {
+		color := colorYellow
+		switch item.result {
+		case mergeMerged, mergeResolved, mergeUpToDate:
+			color = colorGreen
+		case mergeConflict, mergeFailed, mergeVerifyFailed:
+			color = colorRed
+		}
+		line := fmt.Sprintf("  %s%-20s%s %s", color, item.loop.Branch, colorReset, item.result)
+		if item.detail != "" {
+			line += ": " + item.detail
+		}
+		fmt.Println(line)
+	}
+}
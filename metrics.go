@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// iterationDurationBuckets are the upper bounds (seconds) of the iteration
+// duration histogram.
+var iterationDurationBuckets = []float64{30, 60, 120, 300, 600, 900, 1800, 3600}
+
+// verifyDurationBuckets are the upper bounds (seconds) of the verification
+// command duration histogram.
+var verifyDurationBuckets = []float64{1, 5, 15, 30, 60, 120, 300, 600}
+
+// metricsWriter writes the Prometheus text exposition format (version
+// 0.0.4), one metric family at a time.
+type metricsWriter struct {
+	w io.Writer
+}
+
+func (m *metricsWriter) header(name, kind, help string) {
+	fmt.Fprintf(m.w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func (m *metricsWriter) sample(name string, labels map[string]string, value float64) {
+	fmt.Fprintf(m.w, "%s%s %s\n", name, formatLabels(labels), formatMetricValue(value))
+}
+
+// family writes a counter or gauge family with one sample per label value
+// of label (or a single unlabelled sample when label is "").
+func (m *metricsWriter) family(name, kind, help, label string, values map[string]float64) {
+	m.header(name, kind, help)
+	if label == "" {
+		m.sample(name, nil, values[""])
+		return
+	}
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		m.sample(name, map[string]string{label: k}, values[k])
+	}
+}
+
+// histogram writes a histogram family from raw observations.
+func (m *metricsWriter) histogram(name, help string, buckets, observations []float64) {
+	m.header(name, "histogram", help)
+	sum := 0.0
+	for _, o := range observations {
+		sum += o
+	}
+	for _, le := range buckets {
+		n := 0
+		for _, o := range observations {
+			if o <= le {
+				n++
+			}
+		}
+		m.sample(name+"_bucket", map[string]string{"le": formatMetricValue(le)}, float64(n))
+	}
+	m.sample(name+"_bucket", map[string]string{"le": "+Inf"}, float64(len(observations)))
+	m.sample(name+"_sum", nil, sum)
+	m.sample(name+"_count", nil, float64(len(observations)))
+}
+
+func formatLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	escape := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = fmt.Sprintf("%s=\"%s\"", k, escape.Replace(labels[k]))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func formatMetricValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// writeMetrics exposes the loop's telemetry, derived from the session
+// state so every scrape is consistent with /api/status.
+func writeMetrics(w io.Writer) {
+	m := &metricsWriter{w: w}
+	iteration, state := control.state()
+
+	outcomes := map[string]float64{}
+	exits := map[string]float64{}
+	tokens := map[string]float64{"sent": 0, "received": 0}
+	verify := map[string]float64{"passed": 0, "failed": 0}
+	timeouts := map[string]float64{"agent": 0, "verify": 0}
+	var durations, verifyDurations []float64
+	cost, completed := 0.0, 0.0
+	var specs *requirementCounts
+	var coverage *coverageMeasurement
+	sessionID := ""
+
+	if session != nil {
+		session.mu.Lock()
+		sessionID = session.ID
+		specs = session.Requirements
+		coverage = session.CoverageBaseline
+		for _, rec := range session.Iterations {
+			outcomes[rec.Outcome]++
+			durations = append(durations, rec.DurationSeconds)
+			if rec.AgentExitCode != nil {
+				exits[strconv.Itoa(*rec.AgentExitCode)]++
+			}
+			if rec.Outcome == "timeout" {
+				timeouts["agent"]++
+			}
+			tokens["sent"] += float64(rec.TokensSent)
+			tokens["received"] += float64(rec.TokensReceived)
+			cost += rec.Cost
+			completed += float64(len(rec.Completed))
+			for _, v := range rec.Verify {
+				if v.Passed {
+					verify["passed"]++
+				} else {
+					verify["failed"]++
+				}
+				if v.TimedOut {
+					timeouts["verify"]++
+				}
+				verifyDurations = append(verifyDurations, v.DurationSeconds)
+			}
+			if rec.Requirements != nil {
+				specs = rec.Requirements
+			}
+			if rec.Coverage != nil {
+				coverage = rec.Coverage
+			}
+		}
+		session.mu.Unlock()
+	}
+
+	m.header("aider_ralph_info", "gauge", "Information about the running loop, in its labels.")
+	m.sample("aider_ralph_info", map[string]string{"session": sessionID, "specs": config.SpecsFile, "version": version, "state": state}, 1)
+
+	m.family("aider_ralph_iteration", "gauge", "Current iteration number.", "", map[string]float64{"": float64(iteration)})
+	m.family("aider_ralph_max_iterations", "gauge", "Configured maximum number of iterations (0 = unlimited).", "", map[string]float64{"": float64(config.MaxIterations)})
+	m.family("aider_ralph_iterations_total", "counter", "Iterations finished, by outcome.", "outcome", outcomes)
+	m.histogram("aider_ralph_iteration_duration_seconds", "Duration of iterations.", iterationDurationBuckets, durations)
+	m.family("aider_ralph_agent_exits_total", "counter", "aider exits, by exit code (-1 = killed by a signal).", "code", exits)
+	m.family("aider_ralph_timeouts_total", "counter", "Timeouts of aider iterations and verification commands.", "kind", timeouts)
+	m.family("aider_ralph_tokens_total", "counter", "Tokens reported by aider, by direction.", "direction", tokens)
+	m.family("aider_ralph_cost_dollars_total", "counter", "Cost reported by aider, in US dollars.", "", map[string]float64{"": cost})
+	m.family("aider_ralph_verify_total", "counter", "Verification command runs, by result.", "result", verify)
+	m.histogram("aider_ralph_verify_duration_seconds", "Duration of verification commands.", verifyDurationBuckets, verifyDurations)
+	m.family("aider_ralph_requirements_completed_total", "counter", "Requirements checked during this run.", "", map[string]float64{"": completed})
+	if specs != nil {
+		m.family("aider_ralph_requirements_done", "gauge", "Requirements checked in the specs.", "", map[string]float64{"": float64(specs.Done)})
+		m.family("aider_ralph_requirements", "gauge", "Requirements in the specs.", "", map[string]float64{"": float64(specs.Total)})
+	}
+	if coverage != nil && coverage.Percent != nil {
+		m.family("aider_ralph_coverage_percent", "gauge", "Coverage measured by --coverage-cmd after the last iteration.", "", map[string]float64{"": *coverage.Percent})
+	}
+	if coverage != nil && coverage.TestsPassed != nil {
+		m.family("aider_ralph_tests_passed", "gauge", "Passing tests counted by --coverage-cmd after the last iteration.", "", map[string]float64{"": float64(*coverage.TestsPassed)})
+	}
+}
+
+// serveMetrics handles /metrics.
+func serveMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	writeMetrics(w)
+}
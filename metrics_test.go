@@ -0,0 +1,95 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+func TestHistogram(t *testing.T) {
+	var b strings.Builder
+	m := &metricsWriter{w: &b}
+	m.histogram("d_seconds", "Durations.", []float64{1, 5, 10}, []float64{0.5, 1, 4, 12.5})
+
+	want := `# HELP d_seconds Durations.
+# TYPE d_seconds histogram
+d_seconds_bucket{le="1"} 2
+d_seconds_bucket{le="5"} 3
+d_seconds_bucket{le="10"} 3
+d_seconds_bucket{le="+Inf"} 4
+d_seconds_sum 18
+d_seconds_count 4
+`
+	if b.String() != want {
+		t.Errorf("histogram() =\n%s\nwant\n%s", b.String(), want)
+	}
+
+	b.Reset()
+	m.histogram("empty", "No observations.", []float64{1}, nil)
+	if !strings.Contains(b.String(), `empty_bucket{le="+Inf"} 0`) || !strings.Contains(b.String(), "empty_count 0") {
+		t.Errorf("histogram() with no observations =\n%s", b.String())
+	}
+}
+
+func TestFormatLabels(t *testing.T) {
+	got := formatLabels(map[string]string{"b": "x\"y", "a": `c:\d` + "\n"})
+	want := `{a="c:\\d\n",b="x\"y"}`
+	if got != want {
+		t.Errorf("formatLabels() = %s, want %s", got, want)
+	}
+}
+
+func TestWriteMetrics(t *testing.T) {
+	defer func(c Config, s *sessionState) { config, session = c, s }(config, session)
+	defer func(c *loopControl) { control = c }(control)
+
+	exit0, exitKilled := 0, -1
+	percent, passed, failed := 81.5, 42, 0
+	config = Config{SpecsFile: "SPECS.md", MaxIterations: 30}
+	control = &loopControl{iteration: 3}
+	session = &sessionState{
+		ID:           "20260101-120000",
+		Requirements: &requirementCounts{Done: 1, Total: 5},
+		Iterations: []iterationRecord{
+			{
+				Iteration: 1, Outcome: "in_progress", DurationSeconds: 45, AgentExitCode: &exit0,
+				TokensSent: 1200, TokensReceived: 300, Cost: 0.25,
+				Verify: []verifyResult{
+					{Command: "go test ./...", Passed: true, DurationSeconds: 12},
+					{Command: "go vet ./...", Passed: false, DurationSeconds: 2},
+				},
+				Requirements: &requirementCounts{Done: 3, Total: 5},
+				Completed:    []string{"a", "b"},
+			},
+			{
+				Iteration: 2, Outcome: "timeout", DurationSeconds: 1900, AgentExitCode: &exitKilled,
+				Verify:   []verifyResult{{Command: "go test ./...", TimedOut: true, DurationSeconds: 700}},
+				Coverage: &coverageMeasurement{Percent: &percent, TestsPassed: &passed, TestsFailed: &failed},
+			},
+		},
+	}
+
+	var b strings.Builder
+	writeMetrics(&b)
+
+	golden := filepath.Join("testdata", "metrics.golden")
+	if *updateGolden {
+		if err := os.MkdirAll("testdata", 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(golden, []byte(b.String()), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("%v (run go test -run TestWriteMetrics -update to create it)", err)
+	}
+	if b.String() != string(want) {
+		t.Errorf("writeMetrics() =\n%s\nwant (%s)\n%s", b.String(), golden, want)
+	}
+}
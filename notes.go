@@ -0,0 +1,398 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// charsPerToken is the rough characters-per-token ratio used to turn a
+// token budget into a character budget.
+const charsPerToken = 4
+
+// digestLineLength caps the summary line kept for each collapsed notes entry.
+const digestLineLength = 120
+
+// summaryNotesBudget caps the raw notes under --prompt-budget when the
+// prompt also carries the structured NOTES_SUMMARY, which already repeats
+// their blockers, decisions and next steps.
+const summaryNotesBudget = 8000
+
+// Markers left where fitNotesToBudget cut notes text short.
+const (
+	notesTruncatedHead = "... (earlier notes truncated to fit prompt budget)\n"
+	notesTruncatedTail = "\n... (truncated to fit prompt budget)\n"
+)
+
+// notesEntry is one "## ..." section of the notes file (usually "## Iteration N").
+type notesEntry struct {
+	Header string // the "## ..." line, without trailing newline
+	Body   string
+}
+
+func (e notesEntry) String() string {
+	return e.Header + "\n" + e.Body
+}
+
+// notesBudgetReport describes what fitNotesToBudget had to do to the notes.
+type notesBudgetReport struct {
+	OriginalChars int
+	FinalChars    int
+	Full          int  // entries kept verbatim
+	Digested      int  // entries collapsed to a single digest line
+	Dropped       int  // entries omitted entirely
+	Truncated     bool // the newest entry (or notes without entries) had to be cut
+}
+
+// parsePromptBudget converts a --prompt-budget value into a character count.
+// Plain numbers are characters; a "t", "tok" or "tokens" suffix means
+// estimated tokens (charsPerToken characters each).
+func parsePromptBudget(value string) (int, error) {
+	v := strings.ToLower(strings.TrimSpace(value))
+	multiplier := 1
+	for _, suffix := range []string{"tokens", "tok", "t"} {
+		if strings.HasSuffix(v, suffix) {
+			v = strings.TrimSpace(strings.TrimSuffix(v, suffix))
+			multiplier = charsPerToken
+			break
+		}
+	}
+	v = strings.TrimSuffix(v, "chars")
+	n, err := strconv.Atoi(strings.TrimSpace(v))
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid prompt budget %q (expected e.g. 60000 or 15000t)", value)
+	}
+	return n * multiplier, nil
+}
+
+// splitNotesEntries splits the notes file into the text before the first
+// "## " header and the entries that follow, oldest first.
+func splitNotesEntries(notes string) (string, []notesEntry) {
+	var preamble strings.Builder
+	var entries []notesEntry
+	var current *notesEntry
+	var body strings.Builder
+
+	flush := func() {
+		if current != nil {
+			current.Body = body.String()
+			entries = append(entries, *current)
+			body.Reset()
+		}
+	}
+
+	for _, line := range strings.SplitAfter(notes, "\n") {
+		if strings.HasPrefix(line, "## ") {
+			flush()
+			current = &notesEntry{Header: strings.TrimRight(line, "\r\n")}
+			continue
+		}
+		if current == nil {
+			preamble.WriteString(line)
+		} else {
+			body.WriteString(line)
+		}
+	}
+	flush()
+
+	return preamble.String(), entries
+}
+
+// digestLine collapses an entry to its header plus the first non-empty line
+// of its body, truncated to digestLineLength.
+func digestLine(e notesEntry) string {
+	header := strings.TrimSpace(strings.TrimPrefix(e.Header, "## "))
+	first := ""
+	for _, line := range strings.Split(e.Body, "\n") {
+		line = strings.TrimSpace(strings.TrimLeft(strings.TrimSpace(line), "-*"))
+		if line != "" {
+			first = line
+			break
+		}
+	}
+	if len(first) > digestLineLength {
+		first = firstBytes(first, digestLineLength) + "..."
+	}
+	if first == "" {
+		return "- " + header + "\n"
+	}
+	return "- " + header + ": " + first + "\n"
+}
+
+// fitNotesToBudget shrinks the notes to at most avail characters. The text
+// before the first entry is kept (cut down if it is long). The most recent
+// entries are kept in full; older ones are collapsed into a digest and, if
+// even the digest does not fit, dropped oldest first. Notes without "## "
+// entries are cut to their most recent text.
+func fitNotesToBudget(notes string, avail int) (string, notesBudgetReport) {
+	report := notesBudgetReport{OriginalChars: len(notes)}
+	if len(notes) <= avail {
+		report.FinalChars = len(notes)
+		return notes, report
+	}
+	if avail < 0 {
+		avail = 0
+	}
+
+	preamble, entries := splitNotesEntries(notes)
+	if len(entries) == 0 {
+		result := ""
+		if keep := avail - len(notesTruncatedHead); keep > 0 {
+			result = notesTruncatedHead + lastBytes(notes, keep)
+		}
+		report.Truncated = true
+		report.FinalChars = len(result)
+		return result, report
+	}
+
+	// The preamble (a title, standing instructions) comes first, but may
+	// take no more than a quarter of the budget.
+	if strings.TrimSpace(preamble) == "" {
+		preamble = ""
+	} else if len(preamble) > avail/4 {
+		preamble = firstBytes(preamble, avail/4-len(notesTruncatedTail))
+		if preamble != "" {
+			preamble += notesTruncatedTail
+		}
+	}
+	avail -= len(preamble)
+
+	// Newest entries first, as long as they fit verbatim. Beyond the newest
+	// entry, a quarter of the budget is held back for the digest so older
+	// history is still represented.
+	used := 0
+	firstFull := len(entries)
+	for i := len(entries) - 1; i >= 0; i-- {
+		size := len(entries[i].String())
+		limit := avail
+		if i < len(entries)-1 {
+			limit = avail * 3 / 4
+		}
+		if used+size > limit {
+			break
+		}
+		used += size
+		firstFull = i
+	}
+
+	var full strings.Builder
+	if firstFull == len(entries) && len(entries) > 0 {
+		// Not even the newest entry fits: keep as much of it as we can.
+		newest := entries[len(entries)-1].String()
+		keep := avail - len(notesTruncatedTail)
+		if keep > 0 {
+			full.WriteString(firstBytes(newest, keep))
+			full.WriteString(notesTruncatedTail)
+			report.Truncated = true
+			report.Full = 1
+		}
+		firstFull = len(entries) - 1
+		if keep <= 0 {
+			firstFull = len(entries)
+		}
+	} else {
+		for _, e := range entries[firstFull:] {
+			full.WriteString(e.String())
+		}
+		report.Full = len(entries) - firstFull
+	}
+
+	// Collapse older entries into a digest, newest of them first, until the
+	// digest itself runs out of room.
+	remaining := avail - full.Len()
+	older := entries[:firstFull]
+	var lines []string
+	for i := len(older) - 1; i >= 0; i-- {
+		line := digestLine(older[i])
+		// Leave room for the digest heading.
+		if remaining-len(line) < 100 {
+			break
+		}
+		remaining -= len(line)
+		lines = append(lines, line)
+	}
+	report.Digested = len(lines)
+	report.Dropped = len(older) - len(lines)
+
+	var b strings.Builder
+	b.WriteString(preamble)
+	if len(lines) > 0 || report.Dropped > 0 {
+		// With no room left even for the heading, older entries are just
+		// dropped (and counted as such).
+		heading := fmt.Sprintf("## Digest of older notes (%d collapsed, %d omitted to fit prompt budget)\n\n", report.Digested, report.Dropped)
+		if len(heading)+1 <= remaining {
+			b.WriteString(heading)
+			for i := len(lines) - 1; i >= 0; i-- {
+				b.WriteString(lines[i])
+			}
+			b.WriteString("\n")
+		}
+	}
+	b.WriteString(full.String())
+
+	result := b.String()
+	report.FinalChars = len(result)
+	return result, report
+}
+
+// notesArchiveDir holds copies of the notes file taken before compaction.
+var notesArchiveDir = filepath.Join(".ralph", "notes-archive")
+
+// runNotesCommand implements "aider-ralph notes <subcommand>".
+func runNotesCommand(args []string) int {
+	if len(args) == 0 || args[0] != "compact" {
+		fmt.Fprintf(os.Stderr, "%sUsage: aider-ralph notes compact [--notes-file PATH] [-- AIDER_OPTIONS]%s\n", colorRed, colorReset)
+		return 1
+	}
+
+	if _, err := exec.LookPath("aider"); err != nil {
+		logError("aider is not installed. Install with: pip install aider-chat")
+		return 1
+	}
+
+	if config.NotesFile == "" {
+		config.NotesFile = filepath.Join(".ralph", "notes.md")
+	}
+	if !fileExists(config.NotesFile) {
+		logError(fmt.Sprintf("notes file not found: %s", config.NotesFile))
+		return 1
+	}
+
+	if err := compactNotes(nil); err != nil {
+		logError(fmt.Sprintf("Notes compaction failed: %v", err))
+		return 1
+	}
+	return 0
+}
+
+// compactNotes archives the current notes file, asks the agent to summarise
+// it and writes the summary back as the new notes baseline. The archive
+// preserves the append-only history; the notes file is only replaced once a
+// summary has been produced.
+func compactNotes(logWriter io.Writer) error {
+	notes, err := getNotes()
+	if err != nil {
+		return err
+	}
+	preamble, entries := splitNotesEntries(notes)
+	if len(entries) == 0 {
+		logInfo("Notes file has no entries to compact")
+		return nil
+	}
+
+	logInfo(fmt.Sprintf("Compacting %d notes entries (%d chars) from %s", len(entries), len(notes), config.NotesFile))
+
+	var b strings.Builder
+	b.WriteString(strings.TrimSpace(embeddedCompactNotesPrompt))
+	b.WriteString("\n\n")
+	if specs, err := getSpecs(); err == nil && specs != "" {
+		b.WriteString("=== SPECS (for context only) ===\n")
+		b.WriteString(specs)
+		if !strings.HasSuffix(specs, "\n") {
+			b.WriteString("\n")
+		}
+		b.WriteString("=== END SPECS ===\n\n")
+	}
+	b.WriteString("=== NOTES_TO_COMPACT ===\n")
+	b.WriteString(notes)
+	if !strings.HasSuffix(notes, "\n") {
+		b.WriteString("\n")
+	}
+	b.WriteString("=== END NOTES_TO_COMPACT ===\n")
+
+	// --dry-run stops aider from editing files; the summary comes back as output.
+	args := []string{"--message", b.String(), "--yes", "--dry-run"}
+	args = append(args, config.AiderOpts...)
+
+	if config.Verbose {
+		logInfo("Running aider with the notes compaction prompt")
+	}
+
+	result := runAgent(args, logWriter)
+	if result.Err != nil {
+		return result.Err
+	}
+	if result.TimedOut {
+		return fmt.Errorf("aider timed out after %ds", config.Timeout)
+	}
+	if result.Prompt != "" {
+		return fmt.Errorf("aider asked an interactive question (%s): %q", result.PromptKind, result.Prompt)
+	}
+
+	summary := extractRalphNotes(result.Output)
+	if summary == "" {
+		return fmt.Errorf("agent did not produce a <ralph_notes> summary; notes left unchanged")
+	}
+
+	if err := os.MkdirAll(notesArchiveDir, 0755); err != nil {
+		return err
+	}
+	// The archive is the only copy of the history, so never overwrite one
+	// (two compactions can happen within a second)
+	f, err := os.CreateTemp(notesArchiveDir, fmt.Sprintf("notes-%s-*.md", time.Now().Format("20060102-150405")))
+	if err != nil {
+		return fmt.Errorf("failed to archive notes: %v", err)
+	}
+	archive := f.Name()
+	_, err = f.WriteString(notes)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to archive notes: %v", err)
+	}
+
+	// Keep whatever the user wrote above the first entry
+	var compacted strings.Builder
+	if strings.TrimSpace(preamble) == "" {
+		preamble = "# Ralph Notes\n"
+	}
+	compacted.WriteString(strings.TrimRight(preamble, "\n") + "\n\n")
+	compacted.WriteString(fmt.Sprintf("## Compacted summary (%s; %d entries archived to %s)\n\n", timestamp(), len(entries), filepath.ToSlash(archive)))
+	compacted.WriteString(summary)
+	compacted.WriteString("\n")
+
+	if err := os.WriteFile(config.NotesFile, []byte(compacted.String()), 0644); err != nil {
+		return fmt.Errorf("failed to write compacted notes (original archived at %s): %v", archive, err)
+	}
+
+	logOK(fmt.Sprintf("Notes compacted from %d to %d chars (archived to %s)", len(notes), compacted.Len(), archive))
+	return nil
+}
+
+// firstBytes returns at most n bytes from the start of s, backing off to a
+// rune boundary so multi-byte characters are not split.
+func firstBytes(s string, n int) string {
+	if n >= len(s) {
+		return s
+	}
+	if n <= 0 {
+		return ""
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// lastBytes returns at most n bytes from the end of s, starting on a rune
+// boundary.
+func lastBytes(s string, n int) string {
+	if n >= len(s) {
+		return s
+	}
+	if n <= 0 {
+		return ""
+	}
+	start := len(s) - n
+	for start < len(s) && !utf8.RuneStart(s[start]) {
+		start++
+	}
+	return s[start:]
+}
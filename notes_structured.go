@@ -0,0 +1,252 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// noteItem is a single categorised entry extracted from <ralph_notes>.
+type noteItem struct {
+	ID                string `json:"id,omitempty"`
+	Text              string `json:"text"`
+	Iteration         int    `json:"iteration"`
+	ResolvedIteration int    `json:"resolved_iteration,omitempty"`
+}
+
+// structuredNotes is the sidecar kept in .ralph/notes.json. Blockers stay
+// open until resolved, decisions are kept permanently and "next" reflects
+// the most recent iteration that set it.
+type structuredNotes struct {
+	Blockers      []noteItem `json:"blockers"`
+	Decisions     []noteItem `json:"decisions"`
+	Done          []noteItem `json:"done"`
+	Next          []noteItem `json:"next"`
+	NextIteration int        `json:"next_iteration,omitempty"`
+	LastBlockerID int        `json:"last_blocker_id"`
+}
+
+var noteTagRes = map[string]*regexp.Regexp{
+	"done":     regexp.MustCompile(`(?is)<done>\s*(.*?)\s*</done>`),
+	"next":     regexp.MustCompile(`(?is)<next>\s*(.*?)\s*</next>`),
+	"blocker":  regexp.MustCompile(`(?is)<blocker>\s*(.*?)\s*</blocker>`),
+	"decision": regexp.MustCompile(`(?is)<decision>\s*(.*?)\s*</decision>`),
+	"resolved": regexp.MustCompile(`(?is)<resolved>\s*(.*?)\s*</resolved>`),
+}
+
+// structuredNotesPath is where the structured notes sidecar is kept,
+// whatever the notes file is called.
+var structuredNotesPath = filepath.Join(ralphDir, "notes.json")
+
+// structuredNotesFile returns the sidecar path, or "" if notes are disabled
+// (or the notes file is the sidecar path itself).
+func structuredNotesFile() string {
+	if config.NotesFile == "" || filepath.Clean(config.NotesFile) == structuredNotesPath {
+		return ""
+	}
+	return structuredNotesPath
+}
+
+func loadStructuredNotes() (*structuredNotes, error) {
+	sn := &structuredNotes{}
+	path := structuredNotesFile()
+	if path == "" {
+		return sn, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return sn, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(data, sn); err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", path, err)
+	}
+	return sn, nil
+}
+
+func saveStructuredNotes(sn *structuredNotes) error {
+	path := structuredNotesFile()
+	if path == "" {
+		return nil
+	}
+	if dir := filepath.Dir(path); dir != "." && dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	data, err := json.MarshalIndent(sn, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// extractNoteItems returns the items inside every <tag>...</tag> in notes.
+// A tag containing a bullet list yields one item per bullet.
+func extractNoteItems(notes, tag string) []string {
+	var items []string
+	for _, m := range noteTagRes[tag].FindAllStringSubmatch(notes, -1) {
+		body := strings.TrimSpace(m[1])
+		if body == "" {
+			continue
+		}
+		lines := strings.Split(body, "\n")
+		bulleted := true
+		for _, line := range lines {
+			t := strings.TrimSpace(line)
+			if t != "" && !strings.HasPrefix(t, "-") && !strings.HasPrefix(t, "*") {
+				bulleted = false
+				break
+			}
+		}
+		if !bulleted {
+			items = append(items, strings.Join(strings.Fields(body), " "))
+			continue
+		}
+		for _, line := range lines {
+			t := strings.TrimSpace(strings.TrimLeft(strings.TrimSpace(line), "-*"))
+			if t != "" {
+				items = append(items, t)
+			}
+		}
+	}
+	return items
+}
+
+func normalizeNoteText(s string) string {
+	return strings.ToLower(strings.Join(strings.Fields(strings.Trim(s, " .")), " "))
+}
+
+func containsNote(items []noteItem, text string) bool {
+	key := normalizeNoteText(text)
+	for _, it := range items {
+		if normalizeNoteText(it.Text) == key {
+			return true
+		}
+	}
+	return false
+}
+
+// hasStructuredTags reports whether the notes use any categorised tags.
+func hasStructuredTags(notes string) bool {
+	for _, re := range noteTagRes {
+		if re.MatchString(notes) {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeNoteItems folds one iteration's categorised notes into sn.
+func (sn *structuredNotes) mergeNoteItems(iteration int, notes string) {
+	for _, text := range extractNoteItems(notes, "done") {
+		if !containsNote(sn.Done, text) {
+			sn.Done = append(sn.Done, noteItem{Text: text, Iteration: iteration})
+		}
+	}
+
+	for _, text := range extractNoteItems(notes, "decision") {
+		if !containsNote(sn.Decisions, text) {
+			sn.Decisions = append(sn.Decisions, noteItem{Text: text, Iteration: iteration})
+		}
+	}
+
+	if next := extractNoteItems(notes, "next"); len(next) > 0 {
+		sn.Next = nil
+		for _, text := range next {
+			if !containsNote(sn.Next, text) {
+				sn.Next = append(sn.Next, noteItem{Text: text, Iteration: iteration})
+			}
+		}
+		sn.NextIteration = iteration
+	}
+
+	// Resolve before adding so a blocker can be replaced in one iteration.
+	for _, ref := range extractNoteItems(notes, "resolved") {
+		key := normalizeNoteText(ref)
+		for i := range sn.Blockers {
+			b := &sn.Blockers[i]
+			if b.ResolvedIteration != 0 {
+				continue
+			}
+			if strings.EqualFold(b.ID, strings.Trim(ref, "[] ")) || normalizeNoteText(b.Text) == key {
+				b.ResolvedIteration = iteration
+			}
+		}
+	}
+
+	for _, text := range extractNoteItems(notes, "blocker") {
+		if containsNote(sn.openBlockers(), text) {
+			continue
+		}
+		sn.LastBlockerID++
+		sn.Blockers = append(sn.Blockers, noteItem{
+			ID:        fmt.Sprintf("B%d", sn.LastBlockerID),
+			Text:      text,
+			Iteration: iteration,
+		})
+	}
+}
+
+func (sn *structuredNotes) openBlockers() []noteItem {
+	var open []noteItem
+	for _, b := range sn.Blockers {
+		if b.ResolvedIteration == 0 {
+			open = append(open, b)
+		}
+	}
+	return open
+}
+
+// updateStructuredNotes records the categorised parts of an iteration's
+// notes in the sidecar. Freeform notes without tags leave it untouched.
+func updateStructuredNotes(iteration int, notes string) error {
+	if structuredNotesFile() == "" || !hasStructuredTags(notes) {
+		return nil
+	}
+	sn, err := loadStructuredNotes()
+	if err != nil {
+		return err
+	}
+	sn.mergeNoteItems(iteration, notes)
+	return saveStructuredNotes(sn)
+}
+
+// renderStructuredNotes formats the sidecar for the prompt, or returns ""
+// if there is nothing worth showing.
+func renderStructuredNotes(sn *structuredNotes) string {
+	open := sn.openBlockers()
+	if len(open) == 0 && len(sn.Decisions) == 0 && len(sn.Next) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString("Open blockers (resolve with <resolved>ID</resolved>):\n")
+	if len(open) == 0 {
+		b.WriteString("- (none)\n")
+	}
+	for _, it := range open {
+		b.WriteString(fmt.Sprintf("- [%s] %s (since iteration %d)\n", it.ID, it.Text, it.Iteration))
+	}
+	if len(sn.Decisions) > 0 {
+		b.WriteString("\nDecisions (keep to these unless SPECS change):\n")
+		for _, it := range sn.Decisions {
+			b.WriteString(fmt.Sprintf("- %s (iteration %d)\n", it.Text, it.Iteration))
+		}
+	}
+	if len(sn.Next) > 0 {
+		b.WriteString(fmt.Sprintf("\nSuggested next (from iteration %d):\n", sn.NextIteration))
+		for _, it := range sn.Next {
+			b.WriteString("- " + it.Text + "\n")
+		}
+	}
+	if len(sn.Done) > 0 {
+		b.WriteString(fmt.Sprintf("\nDone items recorded so far: %d\n", len(sn.Done)))
+	}
+	return b.String()
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExtractNoteItems(t *testing.T) {
+	tests := []struct {
+		name  string
+		notes string
+		tag   string
+		want  []string
+	}{
+		{name: "single item", notes: "<next>Add tests</next>", tag: "next", want: []string{"Add tests"}},
+		{name: "case-insensitive tag", notes: "<NEXT> Add tests </NEXT>", tag: "next", want: []string{"Add tests"}},
+		{name: "wrapped text is one item", notes: "<decision>Use SQLite\nfor the cache</decision>", tag: "decision", want: []string{"Use SQLite for the cache"}},
+		{name: "bullets split", notes: "<done>\n- parser\n* lexer\n\n-   printer\n</done>", tag: "done", want: []string{"parser", "lexer", "printer"}},
+		{name: "a single bullet", notes: "<done>- parser</done>", tag: "done", want: []string{"parser"}},
+		{name: "mixed lines are one item", notes: "<blocker>\n- CI is red\nbecause of flaky tests\n</blocker>", tag: "blocker", want: []string{"- CI is red because of flaky tests"}},
+		{name: "several tags", notes: "<next>a</next> text <next>b</next>", tag: "next", want: []string{"a", "b"}},
+		{name: "empty tag", notes: "<next>  </next>", tag: "next"},
+		{name: "other tags ignored", notes: "<done>a</done>", tag: "next"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := extractNoteItems(tt.notes, tt.tag)
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("extractNoteItems() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func noteTexts(items []noteItem) string {
+	var texts []string
+	for _, it := range items {
+		text := it.Text
+		if it.ID != "" {
+			text = it.ID + " " + text
+		}
+		if it.ResolvedIteration != 0 {
+			text += " (resolved)"
+		}
+		texts = append(texts, text)
+	}
+	return strings.Join(texts, "|")
+}
+
+func TestMergeNoteItems(t *testing.T) {
+	sn := &structuredNotes{}
+	steps := []struct {
+		notes                           string
+		blockers, decisions, done, next string // after the step, as noteTexts
+	}{
+		{
+			notes:     "<blocker>CI is red</blocker><blocker>No API key</blocker><decision>Use SQLite.</decision><done>parser</done><next>\n- lexer\n- printer\n</next>",
+			blockers:  "B1 CI is red|B2 No API key",
+			decisions: "Use SQLite.",
+			done:      "parser",
+			next:      "lexer|printer",
+		},
+		{
+			// Duplicates differ only in case, spacing and a trailing period
+			notes:     "<blocker>ci  is RED</blocker><decision>use sqlite</decision><done>Parser.</done>",
+			blockers:  "B1 CI is red|B2 No API key",
+			decisions: "Use SQLite.",
+			done:      "parser",
+			next:      "lexer|printer", // no <next>: the previous one stands
+		},
+		{
+			// Resolve by ID (with brackets) and by text; <next> replaces
+			notes:     "<resolved>[b1]</resolved><resolved>no api key.</resolved><next>printer</next><next>Printer</next>",
+			blockers:  "B1 CI is red (resolved)|B2 No API key (resolved)",
+			decisions: "Use SQLite.",
+			done:      "parser",
+			next:      "printer",
+		},
+		{
+			// A resolved blocker that comes back gets a new ID; resolving
+			// first lets a blocker be replaced in one iteration
+			notes:    "<blocker>CI is red</blocker><resolved>B3</resolved><blocker>CI is red again</blocker>",
+			blockers: "B1 CI is red (resolved)|B2 No API key (resolved)|B3 CI is red|B4 CI is red again",
+		},
+		{
+			notes:    "<resolved>B3</resolved><resolved>B9</resolved>",
+			blockers: "B1 CI is red (resolved)|B2 No API key (resolved)|B3 CI is red (resolved)|B4 CI is red again",
+		},
+	}
+	for i, step := range steps {
+		iteration := i + 1
+		sn.mergeNoteItems(iteration, step.notes)
+		if got := noteTexts(sn.Blockers); got != step.blockers {
+			t.Errorf("iteration %d: blockers = %q, want %q", iteration, got, step.blockers)
+		}
+		if step.decisions != "" && noteTexts(sn.Decisions) != step.decisions {
+			t.Errorf("iteration %d: decisions = %q, want %q", iteration, noteTexts(sn.Decisions), step.decisions)
+		}
+		if step.done != "" && noteTexts(sn.Done) != step.done {
+			t.Errorf("iteration %d: done = %q, want %q", iteration, noteTexts(sn.Done), step.done)
+		}
+		if step.next != "" && noteTexts(sn.Next) != step.next {
+			t.Errorf("iteration %d: next = %q, want %q", iteration, noteTexts(sn.Next), step.next)
+		}
+	}
+	if sn.NextIteration != 3 || sn.LastBlockerID != 4 {
+		t.Errorf("NextIteration = %d, LastBlockerID = %d", sn.NextIteration, sn.LastBlockerID)
+	}
+	if sn.Blockers[2].Iteration != 4 || sn.Blockers[2].ResolvedIteration != 5 {
+		t.Errorf("B3 = %+v", sn.Blockers[2])
+	}
+}
+
+func TestUpdateStructuredNotes(t *testing.T) {
+	defer func(c Config) { config = c }(config)
+	defer func(p string) { structuredNotesPath = p }(structuredNotesPath)
+	dir := t.TempDir()
+	structuredNotesPath = filepath.Join(dir, "notes.json")
+	config.NotesFile = filepath.Join(dir, "notes.md")
+
+	if err := updateStructuredNotes(1, "just freeform notes"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(structuredNotesPath); !os.IsNotExist(err) {
+		t.Errorf("freeform notes created the sidecar (%v)", err)
+	}
+
+	if err := updateStructuredNotes(1, "<blocker>CI is red</blocker>"); err != nil {
+		t.Fatal(err)
+	}
+	if err := updateStructuredNotes(2, "<decision>Use SQLite</decision>"); err != nil {
+		t.Fatal(err)
+	}
+	sn, err := loadStructuredNotes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if noteTexts(sn.Blockers) != "B1 CI is red" || noteTexts(sn.Decisions) != "Use SQLite" {
+		t.Errorf("sidecar = %+v", sn)
+	}
+
+	// A notes file at the sidecar path disables the sidecar
+	config.NotesFile = structuredNotesPath
+	if structuredNotesFile() != "" {
+		t.Error("the notes file and sidecar share a path")
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestParsePromptBudget(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    int
+		wantErr bool
+	}{
+		{"60000", 60000, false},
+		{" 60000 ", 60000, false},
+		{"60000chars", 60000, false},
+		{"15000t", 60000, false},
+		{"15000 tok", 60000, false},
+		{"15000tokens", 60000, false},
+		{"0", 0, false},
+		{"-1", 0, true},
+		{"lots", 0, true},
+		{"", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parsePromptBudget(tt.value)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parsePromptBudget(%q) = %d, %v, want %d (error %v)", tt.value, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestSplitNotesEntries(t *testing.T) {
+	preamble, entries := splitNotesEntries("# Notes\nintro\n## Iteration 1\n- a\n\n## Iteration 2\n- b\n")
+	if preamble != "# Notes\nintro\n" {
+		t.Errorf("preamble = %q", preamble)
+	}
+	if len(entries) != 2 || entries[0].Header != "## Iteration 1" || entries[0].Body != "- a\n\n" || entries[1].String() != "## Iteration 2\n- b\n" {
+		t.Errorf("entries = %q", entries)
+	}
+
+	preamble, entries = splitNotesEntries("just text\n")
+	if preamble != "just text\n" || entries != nil {
+		t.Errorf("splitNotesEntries(no headers) = %q, %q", preamble, entries)
+	}
+}
+
+// notesWithEntries builds a notes file of n entries with bodies of size
+// bytes each.
+func notesWithEntries(n, size int) string {
+	var b strings.Builder
+	for i := 1; i <= n; i++ {
+		b.WriteString("## Iteration " + strings.Repeat("I", i) + "\n")
+		b.WriteString("- first line of entry\n")
+		b.WriteString(strings.Repeat("x", size) + "\n")
+	}
+	return b.String()
+}
+
+func TestFitNotesToBudget(t *testing.T) {
+	small := notesWithEntries(3, 10)
+	tests := []struct {
+		name  string
+		notes string
+		avail int
+		check func(t *testing.T, got string, r notesBudgetReport)
+	}{
+		{
+			name:  "fits exactly",
+			notes: small,
+			avail: len(small),
+			check: func(t *testing.T, got string, r notesBudgetReport) {
+				if got != small || r.Full != 0 || r.Dropped != 0 {
+					t.Errorf("notes changed although they fit: %+v", r)
+				}
+			},
+		},
+		{
+			name:  "one byte over",
+			notes: small,
+			avail: len(small) - 1,
+			check: func(t *testing.T, got string, r notesBudgetReport) {
+				if !strings.HasSuffix(got, "## Iteration III\n- first line of entry\nxxxxxxxxxx\n") {
+					t.Errorf("newest entry not kept in full:\n%s", got)
+				}
+			},
+		},
+		{
+			name:  "older entries collapse to a digest",
+			notes: notesWithEntries(10, 200),
+			avail: 1200,
+			check: func(t *testing.T, got string, r notesBudgetReport) {
+				if r.Full == 0 || r.Digested == 0 || r.Full+r.Digested+r.Dropped != 10 {
+					t.Errorf("report = %+v", r)
+				}
+				if !strings.Contains(got, "## Digest of older notes") || !strings.Contains(got, "- Iteration I: first line of entry\n") {
+					t.Errorf("no digest:\n%s", got)
+				}
+			},
+		},
+		{
+			name:  "newest entry truncated",
+			notes: notesWithEntries(2, 1000),
+			avail: 300,
+			check: func(t *testing.T, got string, r notesBudgetReport) {
+				if !r.Truncated || r.Full != 1 || !strings.HasSuffix(got, notesTruncatedTail) {
+					t.Errorf("report = %+v, notes:\n%s", r, got)
+				}
+			},
+		},
+		{
+			name:  "no room at all",
+			notes: small,
+			avail: 0,
+			check: func(t *testing.T, got string, r notesBudgetReport) {
+				if got != "" {
+					t.Errorf("got %q", got)
+				}
+			},
+		},
+		{
+			name:  "preamble kept",
+			notes: "# Project notes\nAlways run make.\n\n" + notesWithEntries(5, 200),
+			avail: 800,
+			check: func(t *testing.T, got string, r notesBudgetReport) {
+				if !strings.HasPrefix(got, "# Project notes\nAlways run make.\n") {
+					t.Errorf("preamble lost:\n%s", got)
+				}
+			},
+		},
+		{
+			name:  "long preamble cut to a quarter",
+			notes: strings.Repeat("p", 2000) + "\n" + notesWithEntries(2, 50),
+			avail: 800,
+			check: func(t *testing.T, got string, r notesBudgetReport) {
+				if strings.Count(got, "p") > 200 || !strings.Contains(got, "## Iteration II") {
+					t.Errorf("notes:\n%s", got)
+				}
+			},
+		},
+		{
+			name:  "no entries keeps the most recent text",
+			notes: "old " + strings.Repeat("a", 1000) + " newest",
+			avail: 200,
+			check: func(t *testing.T, got string, r notesBudgetReport) {
+				if !strings.HasPrefix(got, notesTruncatedHead) || !strings.HasSuffix(got, " newest") || !r.Truncated {
+					t.Errorf("report = %+v, notes %q", r, got)
+				}
+			},
+		},
+		{
+			name:  "multi-byte text is cut on rune boundaries",
+			notes: "## Iteration 1\n" + strings.Repeat("é", 600),
+			avail: 201,
+			check: func(t *testing.T, got string, r notesBudgetReport) {
+				if !r.Truncated {
+					t.Errorf("report = %+v", r)
+				}
+			},
+		},
+		{
+			name:  "multi-byte text without entries",
+			notes: strings.Repeat("日本", 300),
+			avail: 100,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, r := fitNotesToBudget(tt.notes, tt.avail)
+			if len(got) > tt.avail {
+				t.Errorf("got %d chars, budget %d", len(got), tt.avail)
+			}
+			if r.FinalChars != len(got) || r.OriginalChars != len(tt.notes) {
+				t.Errorf("report sizes %+v, got %d chars", r, len(got))
+			}
+			if !utf8.ValidString(got) {
+				t.Errorf("result is not valid UTF-8: %q", got)
+			}
+			if tt.check != nil {
+				tt.check(t, got, r)
+			}
+		})
+	}
+}
+
+func TestDigestLine(t *testing.T) {
+	long := strings.Repeat("ü", digestLineLength)
+	tests := []struct {
+		entry notesEntry
+		want  string
+	}{
+		{notesEntry{Header: "## Iteration 3", Body: "\n- did things\n- more\n"}, "- Iteration 3: did things\n"},
+		{notesEntry{Header: "## Iteration 4", Body: "\n\n"}, "- Iteration 4\n"},
+		{notesEntry{Header: "## Iteration 5", Body: long}, "- Iteration 5: " + strings.Repeat("ü", digestLineLength/2) + "...\n"},
+	}
+	for _, tt := range tests {
+		if got := digestLine(tt.entry); got != tt.want {
+			t.Errorf("digestLine(%q) = %q, want %q", tt.entry.Header, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Notification events.
+const (
+	notifyCompleted     = "completed"
+	notifyMaxIterations = "max_iterations"
+	notifyBlocked       = "blocked"
+	notifyFailures      = "repeated_failures"
+	notifyStalled       = "stalled"
+)
+
+// Defaults for when the repeated_failures and stalled notifications fire.
+const (
+	defaultNotifyFailures = 3
+	defaultNotifyStall    = 5
+)
+
+// Webhook delivery: each attempt is bounded by notifyTimeout, and a failed
+// attempt is retried after notifyRetryDelay, doubling each time.
+const (
+	notifyAttempts = 3
+	notifyTimeout  = 10 * time.Second
+)
+
+var notifyRetryDelay = time.Second
+
+// notifyNotesLimit caps the notes carried by a notification.
+const notifyNotesLimit = 4000
+
+// notification is the JSON body posted to --notify-webhook and the data
+// --notify-cmd templates are rendered with.
+type notification struct {
+	Event         string             `json:"event"`
+	Message       string             `json:"message"`
+	Time          time.Time          `json:"time"`
+	Session       string             `json:"session"`
+	Iteration     int                `json:"iteration"`
+	MaxIterations int                `json:"max_iterations"`
+	Outcome       string             `json:"outcome,omitempty"`
+	Status        string             `json:"status,omitempty"`
+	Reason        string             `json:"reason,omitempty"`
+	Specs         *requirementCounts `json:"specs,omitempty"`
+	Notes         string             `json:"notes,omitempty"` // the most recent <ralph_notes>
+}
+
+// notifier tracks the streaks the repeated_failures and stalled
+// notifications are based on.
+type notifier struct {
+	failures int // consecutive failed iterations
+	stalled  int // consecutive iterations that checked no requirement
+}
+
+var notifications = &notifier{}
+
+// iterationFailed reports whether an iteration outcome counts as a failure.
+func iterationFailed(outcome string) bool {
+	switch outcome {
+	case "error", "timeout", "interactive_prompt", "failed", "verify_failed", "hook_failed", "coverage_failed", "coverage_reverted":
+		return true
+	}
+	return false
+}
+
+// observe updates the streaks with a finished iteration and sends
+// repeated_failures or stalled once a streak reaches its threshold.
+func (n *notifier) observe(rec iterationRecord) {
+	if rec.Kind == "audit" || rec.Outcome == "dry_run" {
+		return
+	}
+
+	if iterationFailed(rec.Outcome) {
+		n.failures++
+	} else {
+		n.failures = 0
+	}
+	if config.NotifyFailures > 0 && n.failures == config.NotifyFailures {
+		notify(notifyFailures, fmt.Sprintf("%d iterations in a row failed (last: %s)", n.failures, rec.Outcome), &rec)
+	}
+
+	if len(rec.Completed) > 0 || (rec.Requirements != nil && rec.Requirements.remaining() == 0) {
+		n.stalled = 0
+	} else {
+		n.stalled++
+	}
+	if config.NotifyStall > 0 && n.stalled == config.NotifyStall {
+		notify(notifyStalled, fmt.Sprintf("No requirement checked in %d iterations", n.stalled), &rec)
+	}
+}
+
+// notifyResult sends the notification for how the loop ended, if that is
+// one worth telling somebody about.
+func notifyResult(result string, iteration int) {
+	rec := session.lastRecord()
+	switch result {
+	case "completed":
+		notify(notifyCompleted, fmt.Sprintf("Loop completed after %d iteration(s)", iteration), rec)
+	case "max_iterations":
+		notify(notifyMaxIterations, fmt.Sprintf("Max iterations (%d) reached without completion", config.MaxIterations), rec)
+	case "unaudited_completion":
+		notify(notifyMaxIterations, fmt.Sprintf("Max iterations (%d) reached; completion was claimed but not audited", config.MaxIterations), rec)
+	case "blocked":
+		notify(notifyBlocked, "The agent reported BLOCKED", rec)
+	case "tasks_exhausted":
+		notify(notifyBlocked, "No requirement left to work on", rec)
+	}
+}
+
+// notify sends a notification to every --notify-webhook and --notify-cmd.
+// Failures are logged; they never stop the loop.
+func notify(event, message string, rec *iterationRecord) {
+	if len(config.NotifyWebhooks) == 0 && len(config.NotifyCmds) == 0 {
+		return
+	}
+	n := newNotification(event, message, rec)
+	if config.DryRun {
+		logInfo(fmt.Sprintf("[DRY RUN] Would notify %s: %s", event, message))
+		return
+	}
+	logInfo(fmt.Sprintf("Notifying %s: %s", event, message))
+
+	body, err := json.Marshal(n)
+	if err != nil {
+		logWarn(fmt.Sprintf("Failed to encode notification: %v", err))
+		return
+	}
+	for _, url := range config.NotifyWebhooks {
+		if err := postNotification(url, body); err != nil {
+			logWarn(fmt.Sprintf("Notification webhook failed: %v", err))
+		}
+	}
+	for _, command := range config.NotifyCmds {
+		if err := runNotifyCmd(command, n, body); err != nil {
+			logWarn(fmt.Sprintf("Notification command failed: %v", err))
+		}
+	}
+}
+
+func newNotification(event, message string, rec *iterationRecord) notification {
+	n := notification{Event: event, Message: message, Time: time.Now(), MaxIterations: config.MaxIterations}
+	if session == nil {
+		return n
+	}
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	n.Session = session.ID
+	n.Specs = session.Requirements
+	for _, r := range session.Iterations {
+		if r.Requirements != nil {
+			n.Specs = r.Requirements
+		}
+	}
+	for i := len(session.Iterations) - 1; i >= 0 && n.Notes == ""; i-- {
+		n.Notes = strings.TrimSpace(session.loadArtifact(session.Iterations[i].Iteration, artifactNotes))
+	}
+	if len(n.Notes) > notifyNotesLimit {
+		n.Notes = firstBytes(n.Notes, notifyNotesLimit) + "\n... (truncated)"
+	}
+	if rec != nil {
+		n.Iteration = rec.Iteration
+		n.Outcome = rec.Outcome
+		n.Status = rec.Status
+		n.Reason = rec.StatusReason
+	}
+	return n
+}
+
+// postNotification posts body to url, retrying network errors and 5xx/429
+// responses.
+func postNotification(url string, body []byte) error {
+	client := &http.Client{Timeout: notifyTimeout}
+	delay := notifyRetryDelay
+	var err error
+	for attempt := 1; attempt <= notifyAttempts; attempt++ {
+		if attempt > 1 {
+			time.Sleep(delay)
+			delay *= 2
+		}
+		var resp *http.Response
+		resp, err = client.Post(url, "application/json", bytes.NewReader(body))
+		if err != nil {
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode/100 == 2 {
+			return nil
+		}
+		err = fmt.Errorf("%s: %s", url, resp.Status)
+		if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode < 500 {
+			return err
+		}
+	}
+	return fmt.Errorf("%v (after %d attempts)", err, notifyAttempts)
+}
+
+// notifyTemplateFuncs are available in --notify-cmd templates. Values are
+// inserted as they are, so {{quote .Notes}} is the safe way to pass text
+// the agent wrote.
+var notifyTemplateFuncs = template.FuncMap{"quote": shellQuote}
+
+// shellQuote quotes s as a single POSIX shell word.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func parseNotifyCmd(command string) (*template.Template, error) {
+	return template.New("notify-cmd").Funcs(notifyTemplateFuncs).Parse(command)
+}
+
+// checkNotifyCmd reports template errors, such as unknown fields, up front
+// rather than when the first notification is sent.
+func checkNotifyCmd(command string) error {
+	tmpl, err := parseNotifyCmd(command)
+	if err != nil {
+		return err
+	}
+	return tmpl.Execute(io.Discard, notification{Specs: &requirementCounts{}})
+}
+
+// runNotifyCmd renders the --notify-cmd template and runs it through the
+// shell, with the notification as JSON on stdin.
+func runNotifyCmd(command string, n notification, body []byte) error {
+	tmpl, err := parseNotifyCmd(command)
+	if err != nil {
+		return err
+	}
+	var rendered strings.Builder
+	if err := tmpl.Execute(&rendered, n); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(config.Timeout)*time.Second)
+	defer cancel()
+	cmd := shellCommand(ctx, rendered.String())
+	cmd.Stdin = bytes.NewReader(body)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		if text := strings.TrimSpace(string(out)); text != "" {
+			return fmt.Errorf("%s: %v\n%s", rendered.String(), err, tailText(text, verifyOutputTail))
+		}
+		return fmt.Errorf("%s: %v", rendered.String(), err)
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPostNotification(t *testing.T) {
+	defer func(d time.Duration) { notifyRetryDelay = d }(notifyRetryDelay)
+	notifyRetryDelay = time.Millisecond
+
+	tests := []struct {
+		name     string
+		statuses []int // response to each attempt; the last one repeats
+		wantErr  bool
+		attempts int32
+	}{
+		{"ok", []int{200}, false, 1},
+		{"accepted", []int{202}, false, 1},
+		{"retry 5xx", []int{503, 500, 200}, false, 3},
+		{"retry 429", []int{429, 204}, false, 2},
+		{"5xx until out of attempts", []int{502}, true, notifyAttempts},
+		{"no retry on 4xx", []int{400}, true, 1},
+		{"no retry on 404", []int{404}, true, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := atomic.AddInt32(&attempts, 1)
+				if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+					t.Errorf("got %s with Content-Type %q", r.Method, r.Header.Get("Content-Type"))
+				}
+				if body, _ := io.ReadAll(r.Body); string(body) != `{"event":"completed"}` {
+					t.Errorf("body = %q", body)
+				}
+				i := int(n) - 1
+				if i >= len(tt.statuses) {
+					i = len(tt.statuses) - 1
+				}
+				w.WriteHeader(tt.statuses[i])
+			}))
+			defer srv.Close()
+
+			err := postNotification(srv.URL, []byte(`{"event":"completed"}`))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("postNotification() error = %v, want error %v", err, tt.wantErr)
+			}
+			if got := atomic.LoadInt32(&attempts); got != tt.attempts {
+				t.Errorf("attempts = %d, want %d", got, tt.attempts)
+			}
+		})
+	}
+}
+
+func TestPostNotificationRetriesNetworkErrors(t *testing.T) {
+	defer func(d time.Duration) { notifyRetryDelay = d }(notifyRetryDelay)
+	notifyRetryDelay = time.Millisecond
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	url := srv.URL
+	srv.Close()
+
+	if err := postNotification(url, []byte(`{}`)); err == nil {
+		t.Fatal("postNotification() to a closed server succeeded")
+	}
+}
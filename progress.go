@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// requirementCounts is how many requirements the specs had, and how many
+// of them were checked, at some point of a run.
+type requirementCounts struct {
+	Done  int `json:"done"`
+	Total int `json:"total"`
+}
+
+// remaining is the number of unchecked requirements.
+func (c requirementCounts) remaining() int {
+	return c.Total - c.Done
+}
+
+// specsSnapshotPath is where the specs are saved after iteration n
+// (0 = before the first iteration).
+func (s *sessionState) specsSnapshotPath(n int) string {
+	ext := filepath.Ext(config.SpecsFile)
+	if ext == "" {
+		ext = ".md"
+	}
+	return filepath.Join(s.dir(), "specs", fmt.Sprintf("%03d%s", n, ext))
+}
+
+// snapshotSpecs saves the specs as they are after iteration n and returns
+// their requirements. Unreadable or unparsable specs yield no requirements.
+func (s *sessionState) snapshotSpecs(n int) ([]requirement, bool) {
+	content, err := getSpecs()
+	if err != nil || config.SpecsFile == "" {
+		return nil, false
+	}
+	if !config.DryRun {
+		path := s.specsSnapshotPath(n)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err == nil {
+			err = os.WriteFile(path, []byte(content), 0644)
+		}
+		if err != nil {
+			logWarn(fmt.Sprintf("Failed to save specs snapshot: %v", err))
+		}
+	}
+	reqs, err := parseSpecs(content)
+	if err != nil {
+		return nil, false
+	}
+	return reqs, true
+}
+
+// startProgress records the requirement counts the run starts from.
+func (s *sessionState) startProgress() {
+	reqs, ok := s.snapshotSpecs(0)
+	if !ok {
+		return
+	}
+	done, total := specsProgress(reqs)
+	s.Requirements = &requirementCounts{Done: done, Total: total}
+	s.requirements = reqs
+}
+
+// trackProgress snapshots the specs after rec's iteration and records
+// which requirements were checked (or unchecked) since the previous one.
+func (s *sessionState) trackProgress(rec *iterationRecord) {
+	reqs, ok := s.snapshotSpecs(rec.Iteration)
+	if !ok {
+		return
+	}
+	before := map[string]bool{}
+	for _, r := range s.requirements {
+		before[r.key()] = r.Done
+	}
+	for _, r := range reqs {
+		wasDone := before[r.key()]
+		switch {
+		case r.Done && !wasDone:
+			rec.Completed = append(rec.Completed, r.Text)
+		case !r.Done && wasDone:
+			rec.Reopened = append(rec.Reopened, r.Text)
+		}
+	}
+	done, total := specsProgress(reqs)
+	rec.Requirements = &requirementCounts{Done: done, Total: total}
+	s.requirements = reqs
+}
+
+var (
+	// aider reports usage after every message, e.g.
+	// "Tokens: 4.5k sent, 1.2k cache hit, 215 received. Cost: $0.02 message, $0.31 session."
+	aiderTokensRe = regexp.MustCompile(`Tokens: ([\d.,]+[kKmM]?) sent(?:, [^\n]*?)?, ([\d.,]+[kKmM]?) received`)
+	aiderCostRe   = regexp.MustCompile(`Cost: \$([\d.,]+) message`)
+)
+
+// parseAiderUsage sums the tokens and cost aider reported for each message
+// in output.
+func parseAiderUsage(output string) (sent, received int, cost float64) {
+	for _, m := range aiderTokensRe.FindAllStringSubmatch(output, -1) {
+		sent += parseTokenCount(m[1])
+		received += parseTokenCount(m[2])
+	}
+	for _, m := range aiderCostRe.FindAllStringSubmatch(output, -1) {
+		if c, err := strconv.ParseFloat(strings.ReplaceAll(m[1], ",", ""), 64); err == nil {
+			cost += c
+		}
+	}
+	return sent, received, cost
+}
+
+// parseTokenCount reads aider's abbreviated token counts ("215", "4.5k",
+// "12k", "1.2M").
+func parseTokenCount(s string) int {
+	s = strings.ReplaceAll(s, ",", "")
+	scale := 1.0
+	switch {
+	case strings.HasSuffix(s, "k"), strings.HasSuffix(s, "K"):
+		scale, s = 1e3, s[:len(s)-1]
+	case strings.HasSuffix(s, "m"), strings.HasSuffix(s, "M"):
+		scale, s = 1e6, s[:len(s)-1]
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0
+	}
+	return int(n*scale + 0.5)
+}
@@ -0,0 +1,22 @@
+//go:build !linux
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// ptySupported reports whether --stdin=pty is available on this platform.
+const ptySupported = false
+
+func openPTY() (master, slave *os.File, err error) {
+	return nil, nil, fmt.Errorf("pseudo-terminals are only supported on Linux")
+}
+
+func attachPTY(cmd *exec.Cmd, slave *os.File) {}
+
+func isPTYClosed(err error) bool {
+	return false
+}
@@ -0,0 +1,389 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// requirementReport is how much of a run went into one requirement.
+type requirementReport struct {
+	Text       string
+	Iteration  int // iteration in which it was checked
+	Iterations int
+	Seconds    float64
+	Cost       float64
+	Reopened   int
+}
+
+// burndownPoint is the number of unchecked requirements after an iteration
+// (iteration 0 is the start of the run).
+type burndownPoint struct {
+	Iteration int
+	Remaining int
+	Total     int
+	Completed []string
+}
+
+// progressReport is everything "aider-ralph report" renders for a session.
+type progressReport struct {
+	Session        *sessionState
+	Burndown       []burndownPoint
+	Requirements   []*requirementReport
+	Open           []string
+	Seconds        float64
+	TokensSent     int
+	TokensReceived int
+	Cost           float64
+}
+
+// runReportCommand implements "aider-ralph report".
+func runReportCommand(args []string) int {
+	if len(args) > 0 {
+		fmt.Fprintf(os.Stderr, "%sUsage: aider-ralph report [--session ID] [--markdown PATH] [--html PATH]%s\n", colorRed, colorReset)
+		return 1
+	}
+
+	s, err := loadSession(config.ReportSession)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%sError: %v%s\n", colorRed, err, colorReset)
+		return 1
+	}
+	r := buildProgressReport(s)
+
+	if config.ReportMarkdown == "" && config.ReportHTML == "" {
+		fmt.Print(renderReportMarkdown(r))
+		return 0
+	}
+	outputs := []struct {
+		path   string
+		render func(*progressReport) string
+	}{
+		{config.ReportMarkdown, renderReportMarkdown},
+		{config.ReportHTML, renderReportHTML},
+	}
+	for _, out := range outputs {
+		if out.path == "" {
+			continue
+		}
+		if err := os.WriteFile(out.path, []byte(out.render(r)), 0644); err != nil {
+			fmt.Fprintf(os.Stderr, "%sError: %v%s\n", colorRed, err, colorReset)
+			return 1
+		}
+		fmt.Fprintf(os.Stderr, "%sWrote %s%s\n", colorGreen, out.path, colorReset)
+	}
+	return 0
+}
+
+// buildProgressReport works out the burndown and what each requirement
+// cost. In driver mode an iteration belongs to the requirement it was
+// given; otherwise the iterations since the previous requirement was
+// checked are shared by the requirements checked in the next one.
+func buildProgressReport(s *sessionState) *progressReport {
+	r := &progressReport{Session: s}
+	if s.Requirements != nil {
+		r.Burndown = append(r.Burndown, burndownPoint{Remaining: s.Requirements.remaining(), Total: s.Requirements.Total})
+	}
+
+	byText := map[string]*requirementReport{}
+	get := func(text string) *requirementReport {
+		key := strings.ToLower(strings.Join(strings.Fields(text), " "))
+		req, ok := byText[key]
+		if !ok {
+			req = &requirementReport{Text: text}
+			byText[key] = req
+			r.Requirements = append(r.Requirements, req)
+		}
+		return req
+	}
+
+	driver := false
+	for _, rec := range s.Iterations {
+		if rec.Task != "" {
+			driver = true
+		}
+	}
+
+	var pending []iterationRecord
+	for _, rec := range s.Iterations {
+		r.Seconds += rec.DurationSeconds
+		r.TokensSent += rec.TokensSent
+		r.TokensReceived += rec.TokensReceived
+		r.Cost += rec.Cost
+		if rec.Requirements != nil {
+			r.Burndown = append(r.Burndown, burndownPoint{Iteration: rec.Iteration, Remaining: rec.Requirements.remaining(), Total: rec.Requirements.Total, Completed: rec.Completed})
+		}
+		for _, text := range rec.Reopened {
+			get(text).Reopened++
+		}
+
+		if driver {
+			if rec.Task != "" {
+				req := get(rec.Task)
+				req.Iterations++
+				req.Seconds += rec.DurationSeconds
+				req.Cost += rec.Cost
+			}
+			for _, text := range rec.Completed {
+				get(text).Iteration = rec.Iteration
+			}
+			continue
+		}
+
+		pending = append(pending, rec)
+		if len(rec.Completed) == 0 {
+			continue
+		}
+		n := float64(len(rec.Completed))
+		for _, text := range rec.Completed {
+			req := get(text)
+			req.Iteration = rec.Iteration
+			req.Iterations += len(pending)
+			for _, p := range pending {
+				req.Seconds += p.DurationSeconds / n
+				req.Cost += p.Cost / n
+			}
+		}
+		pending = nil
+	}
+
+	// Requirements still unchecked at the end, from the last snapshot
+	if reqs := lastSpecsSnapshot(s); reqs != nil {
+		for _, req := range reqs {
+			if !req.Done {
+				r.Open = append(r.Open, req.Text)
+			}
+		}
+	}
+	open := map[string]bool{}
+	for _, text := range r.Open {
+		open[strings.ToLower(strings.Join(strings.Fields(text), " "))] = true
+	}
+	var done []*requirementReport
+	for _, req := range r.Requirements {
+		if req.Iteration > 0 && !open[strings.ToLower(strings.Join(strings.Fields(req.Text), " "))] {
+			done = append(done, req)
+		}
+	}
+	sort.SliceStable(done, func(i, j int) bool { return done[i].Iteration < done[j].Iteration })
+	r.Requirements = done
+	return r
+}
+
+// lastSpecsSnapshot parses the most recent specs snapshot of s, or returns
+// nil if there is none.
+func lastSpecsSnapshot(s *sessionState) []requirement {
+	files, _ := filepath.Glob(filepath.Join(s.dir(), "specs", "[0-9][0-9][0-9]*"))
+	if len(files) == 0 {
+		return nil
+	}
+	sort.Strings(files)
+	data, err := os.ReadFile(files[len(files)-1])
+	if err != nil {
+		return nil
+	}
+	reqs, err := parseSpecs(string(data))
+	if err != nil {
+		return nil
+	}
+	return reqs
+}
+
+func formatSeconds(seconds float64) string {
+	return time.Duration(seconds * float64(time.Second)).Round(time.Second).String()
+}
+
+func formatTokens(n int) string {
+	switch {
+	case n >= 1e6:
+		return fmt.Sprintf("%.1fM", float64(n)/1e6)
+	case n >= 1e3:
+		return fmt.Sprintf("%.1fk", float64(n)/1e3)
+	}
+	return fmt.Sprint(n)
+}
+
+// summaryRows are the overview of a report as label/value pairs.
+func (r *progressReport) summaryRows() [][2]string {
+	s := r.Session
+	rows := [][2]string{{"Started", s.StartedAt.Format("2006-01-02 15:04:05")}}
+	if s.EndedAt != nil {
+		rows = append(rows, [2]string{"Duration", formatSeconds(s.EndedAt.Sub(s.StartedAt).Seconds())})
+		rows = append(rows, [2]string{"Result", fmt.Sprintf("%s (exit %d)", s.Result, s.ExitCode)})
+	} else {
+		rows = append(rows, [2]string{"Result", "still running (or interrupted)"})
+	}
+	rows = append(rows, [2]string{"Iterations", fmt.Sprintf("%d (%s of agent time)", len(s.Iterations), formatSeconds(r.Seconds))})
+	if n := len(r.Burndown); n > 0 {
+		first, last := r.Burndown[0], r.Burndown[n-1]
+		rows = append(rows, [2]string{"Requirements", fmt.Sprintf("%d → %d of %d done (%d checked during the run)", first.Total-first.Remaining, last.Total-last.Remaining, last.Total, len(r.Requirements))})
+	}
+	if r.TokensSent > 0 || r.TokensReceived > 0 {
+		rows = append(rows, [2]string{"Tokens", fmt.Sprintf("%s sent, %s received", formatTokens(r.TokensSent), formatTokens(r.TokensReceived))})
+	}
+	if r.Cost > 0 {
+		rows = append(rows, [2]string{"Cost", fmt.Sprintf("$%.2f", r.Cost)})
+	}
+	return rows
+}
+
+func markdownCell(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, "|", `\|`), "\n", " ")
+}
+
+// renderReportMarkdown renders the report as Markdown.
+func renderReportMarkdown(r *progressReport) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# aider-ralph report: session %s\n\n", r.Session.ID)
+	b.WriteString("| | |\n|---|---|\n")
+	for _, row := range r.summaryRows() {
+		fmt.Fprintf(&b, "| %s | %s |\n", row[0], markdownCell(row[1]))
+	}
+
+	b.WriteString("\n## Burndown\n\n")
+	if len(r.Burndown) == 0 {
+		b.WriteString("No specs progress was recorded for this session.\n")
+	} else {
+		b.WriteString("| Iteration | Remaining | | Checked |\n|---:|---:|---|---|\n")
+		for _, p := range r.Burndown {
+			label := fmt.Sprint(p.Iteration)
+			if p.Iteration == 0 {
+				label = "start"
+			}
+			fmt.Fprintf(&b, "| %s | %d | %s | %s |\n", label, p.Remaining, strings.Repeat("█", p.Remaining), markdownCell(strings.Join(p.Completed, "; ")))
+		}
+	}
+
+	b.WriteString("\n## Requirements\n\n")
+	if len(r.Requirements) == 0 {
+		b.WriteString("No requirement was checked during this session.\n")
+	} else {
+		b.WriteString("| Requirement | Done in | Iterations | Time | Cost |\n|---|---:|---:|---:|---:|\n")
+		for _, req := range r.Requirements {
+			text := req.Text
+			if req.Reopened > 0 {
+				text += fmt.Sprintf(" (reopened %d×)", req.Reopened)
+			}
+			fmt.Fprintf(&b, "| %s | %d | %d | %s | $%.2f |\n", markdownCell(text), req.Iteration, req.Iterations, formatSeconds(req.Seconds), req.Cost)
+		}
+	}
+	if len(r.Open) > 0 {
+		b.WriteString("\n### Still open\n\n")
+		for _, text := range r.Open {
+			fmt.Fprintf(&b, "- %s\n", text)
+		}
+	}
+	return b.String()
+}
+
+// renderReportHTML renders the report as a self-contained HTML page: the
+// progress summary with an SVG burndown chart, then the iteration timeline
+// and each iteration's artifacts.
+func renderReportHTML(r *progressReport) string {
+	esc := html.EscapeString
+	var b strings.Builder
+	fmt.Fprintf(&b, "<!DOCTYPE html>\n<html lang=\"en\">\n<head>\n<meta charset=\"utf-8\">\n<title>aider-ralph report: %s</title>\n", esc(r.Session.ID))
+	b.WriteString(`<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em auto; max-width: 960px; color: #222; }
+table { border-collapse: collapse; margin: 1em 0; }
+th, td { border: 1px solid #ddd; padding: 4px 10px; text-align: left; vertical-align: top; }
+td.num, th.num { text-align: right; }
+.open { color: #666; }
+svg text { font-size: 11px; fill: #555; }
+`)
+	b.WriteString(timelineCSS)
+	b.WriteString(`</style>
+</head>
+<body>
+`)
+	fmt.Fprintf(&b, "<h1>aider-ralph report: session %s</h1>\n<table>\n", esc(r.Session.ID))
+	for _, row := range r.summaryRows() {
+		fmt.Fprintf(&b, "<tr><th>%s</th><td>%s</td></tr>\n", esc(row[0]), esc(row[1]))
+	}
+	b.WriteString("</table>\n<h2>Burndown</h2>\n")
+	if len(r.Burndown) == 0 {
+		b.WriteString("<p>No specs progress was recorded for this session.</p>\n")
+	} else {
+		b.WriteString(renderBurndownSVG(r.Burndown))
+	}
+
+	b.WriteString("<h2>Requirements</h2>\n")
+	if len(r.Requirements) == 0 {
+		b.WriteString("<p>No requirement was checked during this session.</p>\n")
+	} else {
+		b.WriteString("<table>\n<tr><th>Requirement</th><th class=\"num\">Done in</th><th class=\"num\">Iterations</th><th class=\"num\">Time</th><th class=\"num\">Cost</th></tr>\n")
+		for _, req := range r.Requirements {
+			text := esc(req.Text)
+			if req.Reopened > 0 {
+				text += fmt.Sprintf(" <em>(reopened %d×)</em>", req.Reopened)
+			}
+			fmt.Fprintf(&b, "<tr><td>%s</td><td class=\"num\">%d</td><td class=\"num\">%d</td><td class=\"num\">%s</td><td class=\"num\">$%.2f</td></tr>\n", text, req.Iteration, req.Iterations, formatSeconds(req.Seconds), req.Cost)
+		}
+		b.WriteString("</table>\n")
+	}
+	if len(r.Open) > 0 {
+		b.WriteString("<h3>Still open</h3>\n<ul class=\"open\">\n")
+		for _, text := range r.Open {
+			fmt.Fprintf(&b, "<li>%s</li>\n", esc(text))
+		}
+		b.WriteString("</ul>\n")
+	}
+	b.WriteString(renderTimelineHTML(r))
+	b.WriteString(renderIterationsHTML(r))
+	b.WriteString("</body>\n</html>\n")
+	return b.String()
+}
+
+// renderBurndownSVG draws remaining requirements against iterations.
+func renderBurndownSVG(points []burndownPoint) string {
+	const (
+		width, height = 720, 260
+		left, right   = 40, 20
+		top, bottom   = 15, 35
+	)
+	maxX, maxY := 1, 1
+	for _, p := range points {
+		if p.Iteration > maxX {
+			maxX = p.Iteration
+		}
+		if p.Total > maxY {
+			maxY = p.Total
+		}
+	}
+	x := func(i int) float64 { return left + float64(i)*float64(width-left-right)/float64(maxX) }
+	y := func(n int) float64 { return top + float64(maxY-n)*float64(height-top-bottom)/float64(maxY) }
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%d\" height=\"%d\" viewBox=\"0 0 %d %d\">\n", width, height, width, height)
+	fmt.Fprintf(&b, "<line x1=\"%d\" y1=\"%.1f\" x2=\"%d\" y2=\"%.1f\" stroke=\"#999\"/>\n", left, y(0), width-right, y(0))
+	fmt.Fprintf(&b, "<line x1=\"%d\" y1=\"%d\" x2=\"%d\" y2=\"%.1f\" stroke=\"#999\"/>\n", left, top, left, y(0))
+	fmt.Fprintf(&b, "<text x=\"%d\" y=\"%.1f\" text-anchor=\"end\">%d</text>\n", left-6, y(maxY)+4, maxY)
+	fmt.Fprintf(&b, "<text x=\"%d\" y=\"%.1f\" text-anchor=\"end\">0</text>\n", left-6, y(0)+4)
+	fmt.Fprintf(&b, "<text x=\"%d\" y=\"%d\" text-anchor=\"middle\">iteration</text>\n", (left+width-right)/2, height-4)
+	step := (maxX + 9) / 10
+	for i := 0; i <= maxX; i += step {
+		fmt.Fprintf(&b, "<text x=\"%.1f\" y=\"%.1f\" text-anchor=\"middle\">%d</text>\n", x(i), y(0)+15, i)
+	}
+
+	var path []string
+	for i, p := range points {
+		if i > 0 {
+			path = append(path, fmt.Sprintf("%.1f,%.1f", x(p.Iteration), y(points[i-1].Remaining)))
+		}
+		path = append(path, fmt.Sprintf("%.1f,%.1f", x(p.Iteration), y(p.Remaining)))
+	}
+	fmt.Fprintf(&b, "<polyline fill=\"none\" stroke=\"#2b7bb9\" stroke-width=\"2\" points=\"%s\"/>\n", strings.Join(path, " "))
+	for _, p := range points {
+		title := fmt.Sprintf("Iteration %d: %d of %d remaining", p.Iteration, p.Remaining, p.Total)
+		if len(p.Completed) > 0 {
+			title += "\nChecked: " + strings.Join(p.Completed, "; ")
+		}
+		fmt.Fprintf(&b, "<circle cx=\"%.1f\" cy=\"%.1f\" r=\"3.5\" fill=\"#2b7bb9\"><title>%s</title></circle>\n", x(p.Iteration), y(p.Remaining), html.EscapeString(title))
+	}
+	b.WriteString("</svg>\n")
+	return b.String()
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"path/filepath"
+	"strings"
+)
+
+// artifactDisplayLimit caps how much of one artifact the HTML report embeds.
+const artifactDisplayLimit = 256 * 1024
+
+// outcomeClass groups iteration outcomes for coloring the timeline.
+func outcomeClass(outcome string) string {
+	switch outcome {
+	case "completed", "audit_confirmed":
+		return "ok"
+	case "in_progress", "no_status", "dry_run":
+		return "progress"
+	case "needs_input", "verify_failed", "audit_rejected", "rejected", "timeout":
+		return "warn"
+	}
+	return "bad"
+}
+
+// timelineCSS styles the timeline and iteration sections of the HTML report.
+const timelineCSS = `.timeline { display: flex; align-items: stretch; height: 28px; margin: 1em 0; border: 1px solid #ddd; }
+.timeline a { display: block; min-width: 3px; border-right: 1px solid #fff; }
+.ok { background: #b7e4c7; } .progress { background: #a9cce3; } .warn { background: #ffe8a3; } .bad { background: #f5b7b1; }
+td.ok, td.progress, td.warn, td.bad { white-space: nowrap; }
+details { margin: 0.4em 0; } details > details { margin-left: 1.5em; }
+summary { cursor: pointer; }
+pre { background: #f7f7f7; border: 1px solid #eee; padding: 8px; overflow-x: auto; font-size: 12px; line-height: 1.35; }
+pre.diff span { display: block; }
+.d-add { background: #e6ffed; color: #22863a; } .d-del { background: #ffeef0; color: #b31d28; }
+.d-hunk { color: #6f42c1; } .d-file { font-weight: bold; color: #444; }
+ul.events { font-size: 13px; color: #555; }
+`
+
+// renderTimelineHTML renders the iteration timeline: a bar per iteration,
+// as wide as it took and colored by outcome, and a summary table.
+func renderTimelineHTML(r *progressReport) string {
+	esc := html.EscapeString
+	s := r.Session
+	var b strings.Builder
+	b.WriteString("<h2>Timeline</h2>\n")
+	if len(s.Iterations) == 0 {
+		b.WriteString("<p>No iteration was recorded for this session.</p>\n")
+		return b.String()
+	}
+
+	b.WriteString("<div class=\"timeline\">\n")
+	for _, rec := range s.Iterations {
+		grow := rec.DurationSeconds
+		if grow < 1 {
+			grow = 1
+		}
+		title := fmt.Sprintf("Iteration %d: %s, %s", rec.Iteration, rec.Outcome, formatSeconds(rec.DurationSeconds))
+		fmt.Fprintf(&b, "<a href=\"#iteration-%d\" class=\"%s\" style=\"flex-grow: %.0f\" title=\"%s\"></a>\n", rec.Iteration, outcomeClass(rec.Outcome), grow, esc(title))
+	}
+	b.WriteString("</div>\n")
+
+	b.WriteString("<table>\n<tr><th class=\"num\">#</th><th>Started</th><th class=\"num\">Duration</th><th>Outcome</th><th>Model</th><th class=\"num\">Cost</th><th>Verification</th><th>Task / checked</th></tr>\n")
+	for _, rec := range s.Iterations {
+		outcome := rec.Outcome
+		if rec.Kind != "" {
+			outcome += " (" + rec.Kind + ")"
+		}
+		cost := ""
+		if rec.Cost > 0 {
+			cost = fmt.Sprintf("$%.2f", rec.Cost)
+		}
+		var work []string
+		if rec.Task != "" {
+			work = append(work, "task: "+rec.Task)
+		}
+		for _, text := range rec.Completed {
+			work = append(work, "✓ "+text)
+		}
+		fmt.Fprintf(&b, "<tr><td class=\"num\"><a href=\"#iteration-%d\">%d</a></td><td>%s</td><td class=\"num\">%s</td><td class=\"%s\">%s</td><td>%s</td><td class=\"num\">%s</td><td>%s</td><td>%s</td></tr>\n",
+			rec.Iteration, rec.Iteration, rec.StartedAt.Format("15:04:05"), formatSeconds(rec.DurationSeconds),
+			outcomeClass(rec.Outcome), esc(outcome), esc(rec.Model), cost, esc(verifySummary(rec.Verify)), esc(strings.Join(work, "; ")))
+	}
+	b.WriteString("</table>\n")
+	return b.String()
+}
+
+func verifySummary(results []verifyResult) string {
+	if len(results) == 0 {
+		return ""
+	}
+	passed := 0
+	for _, v := range results {
+		if v.Passed {
+			passed++
+		}
+	}
+	return fmt.Sprintf("%d/%d passed", passed, len(results))
+}
+
+// renderIterationsHTML renders each iteration's details: its events and
+// verification results, and its prompt, output, notes and diff as
+// expandable sections.
+func renderIterationsHTML(r *progressReport) string {
+	esc := html.EscapeString
+	s := r.Session
+	events := map[int][]sessionEvent{}
+	for _, ev := range s.loadEvents() {
+		events[ev.Iteration] = append(events[ev.Iteration], ev)
+	}
+
+	var b strings.Builder
+	b.WriteString("<h2>Iterations</h2>\n")
+	for _, rec := range s.Iterations {
+		title := fmt.Sprintf("Iteration %d — %s, %s", rec.Iteration, rec.Outcome, formatSeconds(rec.DurationSeconds))
+		if rec.StatusReason != "" {
+			title += ": " + rec.StatusReason
+		}
+		fmt.Fprintf(&b, "<details id=\"iteration-%d\">\n<summary class=\"%s\">%s</summary>\n", rec.Iteration, outcomeClass(rec.Outcome), esc(title))
+
+		if evs := events[rec.Iteration]; len(evs) > 0 {
+			b.WriteString("<ul class=\"events\">\n")
+			for _, ev := range evs {
+				detail := strings.TrimSpace(strings.Join([]string{ev.Status, ev.Outcome, ev.Message}, " "))
+				fmt.Fprintf(&b, "<li>%s %s %s</li>\n", ev.Time.Format("15:04:05"), esc(ev.Type), esc(detail))
+			}
+			b.WriteString("</ul>\n")
+		}
+
+		if len(rec.Verify) > 0 {
+			b.WriteString("<table>\n<tr><th>Verification</th><th class=\"num\">Exit code</th><th class=\"num\">Duration</th></tr>\n")
+			for _, v := range rec.Verify {
+				class := "ok"
+				if !v.Passed {
+					class = "bad"
+				}
+				code := fmt.Sprint(v.ExitCode)
+				if v.TimedOut {
+					code = "timed out"
+				}
+				fmt.Fprintf(&b, "<tr><td><code>%s</code></td><td class=\"num %s\">%s</td><td class=\"num\">%s</td></tr>\n", esc(v.Command), class, code, formatSeconds(v.DurationSeconds))
+			}
+			b.WriteString("</table>\n")
+		}
+
+		artifacts := []struct{ name, label string }{
+			{artifactPrompt, "Prompt"},
+			{artifactOutput, "Output"},
+			{artifactNotes, "Notes"},
+			{artifactDiff, "Diff"},
+			{artifactVerify, "Verification output"},
+			{artifactHooks, "Hook output"},
+			{artifactCoverage, "Coverage output"},
+		}
+		for _, a := range artifacts {
+			content := s.loadArtifact(rec.Iteration, a.name)
+			if content == "" {
+				continue
+			}
+			truncated := ""
+			if len(content) > artifactDisplayLimit {
+				content = firstBytes(content, artifactDisplayLimit)
+				truncated = fmt.Sprintf("\n... truncated; see %s\n", filepath.ToSlash(filepath.Join(s.iterationDir(rec.Iteration), a.name)))
+			}
+			fmt.Fprintf(&b, "<details>\n<summary>%s</summary>\n", a.label)
+			if a.name == artifactDiff {
+				b.WriteString(renderDiffHTML(content))
+			} else {
+				fmt.Fprintf(&b, "<pre>%s</pre>\n", esc(content))
+			}
+			if truncated != "" {
+				fmt.Fprintf(&b, "<p><em>%s</em></p>\n", esc(truncated))
+			}
+			b.WriteString("</details>\n")
+		}
+		b.WriteString("</details>\n")
+	}
+
+	if evs := events[0]; len(evs) > 0 {
+		b.WriteString("<h3>Session events</h3>\n<ul class=\"events\">\n")
+		for _, ev := range evs {
+			detail := strings.TrimSpace(strings.Join([]string{ev.Outcome, ev.Message}, " "))
+			fmt.Fprintf(&b, "<li>%s %s %s</li>\n", ev.Time.Format("2006-01-02 15:04:05"), esc(ev.Type), esc(detail))
+		}
+		b.WriteString("</ul>\n")
+	}
+	return b.String()
+}
+
+// renderDiffHTML highlights a unified diff line by line.
+func renderDiffHTML(diff string) string {
+	var b strings.Builder
+	b.WriteString("<pre class=\"diff\">")
+	for _, line := range strings.Split(strings.TrimRight(diff, "\n"), "\n") {
+		class := ""
+		switch {
+		case strings.HasPrefix(line, "diff --git"), strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"),
+			strings.HasPrefix(line, "index "), strings.HasPrefix(line, "new file"), strings.HasPrefix(line, "deleted file"),
+			strings.HasPrefix(line, "# new untracked file"):
+			class = "d-file"
+		case strings.HasPrefix(line, "@@"):
+			class = "d-hunk"
+		case strings.HasPrefix(line, "+"):
+			class = "d-add"
+		case strings.HasPrefix(line, "-"):
+			class = "d-del"
+		}
+		if line == "" {
+			line = " "
+		}
+		if class == "" {
+			fmt.Fprintf(&b, "<span>%s</span>", html.EscapeString(line))
+		} else {
+			fmt.Fprintf(&b, "<span class=\"%s\">%s</span>", class, html.EscapeString(line))
+		}
+	}
+	b.WriteString("</pre>\n")
+	return b.String()
+}
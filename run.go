@@ -0,0 +1,364 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// worktreesDir holds one git worktree per loop started by "run".
+var worktreesDir = filepath.Join(ralphDir, "worktrees")
+
+// parallelSummaryFile records the outcome of the last "run".
+var parallelSummaryFile = filepath.Join(ralphDir, "parallel.json")
+
+// defaultParallel is how many loops "run" executes at once.
+const defaultParallel = 2
+
+// loopPrefixColors cycle through the loops so their output is easy to tell apart.
+var loopPrefixColors = []string{colorCyan, colorPurple, colorBlue, colorGreen, colorYellow}
+
+// unsafeBranchChars are replaced when a specs file name becomes a branch name.
+var unsafeBranchChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// parallelLoop is one loop of a "run", persisted in .ralph/parallel.json.
+type parallelLoop struct {
+	Name       string     `json:"name"`
+	Specs      string     `json:"specs"`
+	Branch     string     `json:"branch"`
+	Worktree   string     `json:"worktree"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	EndedAt    *time.Time `json:"ended_at,omitempty"`
+	ExitCode   int        `json:"exit_code"`
+	Result     string     `json:"result"`
+	Iterations int        `json:"iterations"`
+	Session    string     `json:"session,omitempty"`
+	Error      string     `json:"error,omitempty"`
+
+	color string
+	cmd   *exec.Cmd
+}
+
+// parallelRun is the content of .ralph/parallel.json.
+type parallelRun struct {
+	StartedAt time.Time       `json:"started_at"`
+	EndedAt   time.Time       `json:"ended_at"`
+	Parallel  int             `json:"parallel"`
+	Loops     []*parallelLoop `json:"loops"`
+}
+
+// runRunCommand implements "aider-ralph run": one independent loop per
+// specs file, each in its own git worktree and branch, at most
+// config.Parallel at a time.
+func runRunCommand(args []string) int {
+	if len(args) > 0 {
+		fmt.Fprintf(os.Stderr, "%sUsage: aider-ralph run [--parallel N] --specs 'GLOB' [OPTIONS] [-- AIDER_OPTIONS]%s\n", colorRed, colorReset)
+		return 1
+	}
+	if config.Approve || config.StdinMode == stdinInherit {
+		logError("run cannot be combined with --approve or --stdin=inherit: the loops have no terminal")
+		return 1
+	}
+	if config.Serve != "" {
+		logWarn("--serve is ignored by run: the loops would all need the same address")
+	}
+	if config.Parallel < 1 {
+		logError("--parallel must be at least 1")
+		return 1
+	}
+	if !isGitRepo() {
+		logError("run needs a git repository (each loop gets its own worktree)")
+		return 1
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		logError(fmt.Sprintf("Cannot locate the aider-ralph executable: %v", err))
+		return 1
+	}
+
+	loops, err := planParallelLoops(config.SpecsFile)
+	if err != nil {
+		logError(err.Error())
+		return 1
+	}
+
+	if !config.NoLint {
+		failed := false
+		for _, loop := range loops {
+			if !lintSpecsFile(loop.Specs) {
+				failed = true
+			}
+		}
+		if failed {
+			logError("Specs lint failed; fix the specs or pass --no-lint")
+			return 1
+		}
+	}
+
+	prefix, err := gitOutput("rev-parse", "--show-prefix")
+	if err != nil {
+		logError(err.Error())
+		return 1
+	}
+
+	for _, loop := range loops {
+		loop.Worktree, err = filepath.Abs(filepath.Join(worktreesDir, loop.Name))
+		if err == nil {
+			err = prepareWorktree(loop, prefix)
+		}
+		if err != nil {
+			logError(fmt.Sprintf("[%s] %v", loop.Name, err))
+			return 1
+		}
+	}
+
+	run := &parallelRun{StartedAt: time.Now(), Parallel: config.Parallel, Loops: loops}
+	logInfo(fmt.Sprintf("Running %d loops, %d at a time", len(loops), config.Parallel))
+
+	var mu sync.Mutex // guards terminal output and the loops' process state
+	interrupted := false
+
+	// Ctrl-C reaches the loops directly (same process group); other signals
+	// are passed on. Either way, wait for them so the summary is complete.
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+	go func() {
+		for sig := range sigs {
+			mu.Lock()
+			if !interrupted {
+				fmt.Println()
+				logWarn("Interrupted; waiting for running loops to stop")
+			}
+			interrupted = true
+			for _, loop := range loops {
+				if loop.cmd != nil && loop.cmd.Process != nil && loop.EndedAt == nil {
+					_ = loop.cmd.Process.Signal(sig)
+				}
+			}
+			mu.Unlock()
+		}
+	}()
+
+	forwarded := forwardedLoopArgs(os.Args[1:])
+	sem := make(chan struct{}, config.Parallel)
+	var wg sync.WaitGroup
+	for _, loop := range loops {
+		sem <- struct{}{}
+		mu.Lock()
+		stop := interrupted
+		mu.Unlock()
+		if stop {
+			// Never started because of the interrupt: not a success
+			<-sem
+			loop.Result = "skipped"
+			loop.ExitCode = 130
+			continue
+		}
+
+		wg.Add(1)
+		go func(loop *parallelLoop) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			runParallelLoop(loop, exe, filepath.Join(loop.Worktree, prefix), forwarded, &mu)
+		}(loop)
+	}
+	wg.Wait()
+	run.EndedAt = time.Now()
+
+	if data, err := json.MarshalIndent(run, "", "  "); err == nil {
+		if err := os.WriteFile(parallelSummaryFile, append(data, '\n'), 0644); err != nil {
+			logWarn(fmt.Sprintf("Failed to write %s: %v", parallelSummaryFile, err))
+		}
+	}
+
+	printParallelSummary(run)
+
+	if interrupted {
+		return 130
+	}
+	for _, loop := range loops {
+		if loop.ExitCode != 0 || loop.Error != "" {
+			return 1
+		}
+	}
+	return 0
+}
+
+// planParallelLoops expands the specs glob into one loop per file, named
+// after the file.
+func planParallelLoops(pattern string) ([]*parallelLoop, error) {
+	files, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid specs pattern %q: %v", pattern, err)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no specs files match %q", pattern)
+	}
+	sort.Strings(files)
+
+	var loops []*parallelLoop
+	seen := map[string]string{}
+	for i, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+		name = strings.Trim(unsafeBranchChars.ReplaceAllString(name, "-"), "-.")
+		if name == "" {
+			return nil, fmt.Errorf("cannot derive a loop name from %s", file)
+		}
+		if other, ok := seen[name]; ok {
+			return nil, fmt.Errorf("%s and %s would share the loop name %q; rename one of them", other, file, name)
+		}
+		seen[name] = file
+		loops = append(loops, &parallelLoop{
+			Name:   name,
+			Specs:  filepath.ToSlash(file),
+			Branch: "ralph/" + name,
+			color:  loopPrefixColors[i%len(loopPrefixColors)],
+		})
+	}
+	return loops, nil
+}
+
+// prepareWorktree creates the loop's worktree on its own branch, or reuses
+// it if an earlier run left it behind (so loops can be resumed). A new
+// worktree starts from HEAD, so the specs file is copied in from the
+// current checkout in case it has uncommitted changes. prefix is the
+// current directory relative to the repository root.
+func prepareWorktree(loop *parallelLoop, prefix string) error {
+	if fileExists(loop.Worktree) {
+		logInfo(fmt.Sprintf("[%s] Reusing worktree %s", loop.Name, loop.Worktree))
+		return nil
+	}
+
+	if _, err := gitOutput("rev-parse", "--verify", "--quiet", "refs/heads/"+loop.Branch); err == nil {
+		if _, err := gitOutput("worktree", "add", loop.Worktree, loop.Branch); err != nil {
+			return err
+		}
+	} else if _, err := gitOutput("worktree", "add", "-b", loop.Branch, loop.Worktree, "HEAD"); err != nil {
+		return err
+	}
+	logOK(fmt.Sprintf("[%s] Created worktree %s on branch %s", loop.Name, loop.Worktree, loop.Branch))
+
+	specs, err := os.ReadFile(loop.Specs)
+	if err != nil {
+		return err
+	}
+	dest := filepath.Join(loop.Worktree, prefix, loop.Specs)
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(dest, specs, 0644)
+}
+
+// runParallelLoop runs one loop as a child aider-ralph in dir, prefixing
+// each line of its output with the loop name.
+func runParallelLoop(loop *parallelLoop, exe, dir string, forwarded []string, mu *sync.Mutex) {
+	started := time.Now()
+	args := []string{
+		"--specs", loop.Specs,
+		"--notes-file", filepath.Join(ralphDir, "notes.md"),
+		"--log", filepath.Join(ralphDir, "ralph.log"),
+	}
+	args = append(args, forwarded...)
+
+	cmd := exec.Command(exe, args...)
+	cmd.Dir = dir
+	pipe, err := cmd.StdoutPipe()
+	if err == nil {
+		cmd.Stderr = cmd.Stdout
+		mu.Lock()
+		loop.StartedAt = &started
+		loop.cmd = cmd
+		err = cmd.Start()
+		mu.Unlock()
+	}
+	if err != nil {
+		loop.Error = err.Error()
+		loop.Result = "error"
+		loop.ExitCode = -1
+		logError(fmt.Sprintf("[%s] Failed to start loop: %v", loop.Name, err))
+		return
+	}
+
+	prefix := fmt.Sprintf("%s[%s]%s ", loop.color, loop.Name, colorReset)
+	onLine := func(line string) {
+		// A carriage return would overwrite the prefix; keep what it redraws
+		if i := strings.LastIndexByte(line, '\r'); i >= 0 {
+			line = line[i+1:]
+		}
+		mu.Lock()
+		fmt.Println(prefix + line)
+		mu.Unlock()
+	}
+	if err := streamLines(pipe, nil, onLine, nil); err != nil {
+		onLine(fmt.Sprintf("error reading output: %v", err))
+	}
+	waitErr := cmd.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	ended := time.Now()
+	loop.EndedAt = &ended
+	loop.ExitCode = cmd.ProcessState.ExitCode()
+	if waitErr != nil && loop.ExitCode < 0 {
+		loop.Error = waitErr.Error()
+	}
+
+	// The child records its own session; pick up the one it just wrote.
+	loop.Result = "unknown"
+	if s, err := loadSessionFrom(filepath.Join(dir, sessionsDir), ""); err == nil && !s.StartedAt.Before(started.Truncate(time.Second)) {
+		loop.Session = s.ID
+		loop.Result = s.Result
+		loop.Iterations = len(s.Iterations)
+	}
+}
+
+// forwardedLoopArgs returns our own command line minus the "run" command,
+// the options that "run" sets per loop and --serve, for passing to each loop.
+func forwardedLoopArgs(args []string) []string {
+	var out []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--":
+			return append(out, args[i:]...)
+		case i == 0 && arg == "run":
+		case arg == "--parallel" || arg == "-s" || arg == "--specs" || arg == "--serve" || arg == "--serve-token":
+			i++
+		case strings.HasPrefix(arg, "--parallel=") || strings.HasPrefix(arg, "-s=") || strings.HasPrefix(arg, "--specs="),
+			strings.HasPrefix(arg, "--serve=") || strings.HasPrefix(arg, "--serve-token="):
+		default:
+			out = append(out, arg)
+		}
+	}
+	return out
+}
+
+func printParallelSummary(run *parallelRun) {
+	fmt.Println()
+	fmt.Printf("%s📊 Parallel run summary (%s)%s\n", colorBold, run.EndedAt.Sub(run.StartedAt).Round(time.Second), colorReset)
+	for _, loop := range run.Loops {
+		color := colorGreen
+		if loop.ExitCode != 0 || loop.Error != "" {
+			color = colorRed
+		} else if loop.Result != "completed" {
+			color = colorYellow
+		}
+		duration := ""
+		if loop.StartedAt != nil && loop.EndedAt != nil {
+			duration = ", " + loop.EndedAt.Sub(*loop.StartedAt).Round(time.Second).String()
+		}
+		fmt.Printf("  %s%-20s%s %-12s exit %d, %d iterations%s  (%s)\n", color, loop.Name, colorReset, loop.Result, loop.ExitCode, loop.Iterations, duration, loop.Branch)
+	}
+	fmt.Printf("%s📋 Summary: %s%s\n", colorCyan, parallelSummaryFile, colorReset)
+}
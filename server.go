@@ -0,0 +1,362 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// serveRecentLines is how much recent agent output a new /api/events
+// subscriber is sent before the live stream.
+const serveRecentLines = 200
+
+// sseMessage is one Server-Sent Event: "output" for a line of agent output,
+// otherwise the type of a session event with the event as JSON.
+type sseMessage struct {
+	Event string
+	Data  string
+}
+
+// eventHub fans agent output and session events out to /api/events
+// subscribers.
+type eventHub struct {
+	mu     sync.Mutex
+	subs   map[chan sseMessage]bool
+	recent []sseMessage
+}
+
+// hub is nil unless --serve is used; publishing to a nil hub does nothing.
+var hub *eventHub
+
+func (h *eventHub) publish(event, data string) {
+	if h == nil {
+		return
+	}
+	msg := sseMessage{Event: event, Data: data}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if event == "output" {
+		h.recent = append(h.recent, msg)
+		if len(h.recent) > serveRecentLines {
+			h.recent = h.recent[len(h.recent)-serveRecentLines:]
+		}
+	}
+	for ch := range h.subs {
+		select {
+		case ch <- msg:
+		default: // slow client; drop rather than stall the loop
+		}
+	}
+}
+
+func (h *eventHub) subscribe() (chan sseMessage, []sseMessage) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	ch := make(chan sseMessage, 256)
+	h.subs[ch] = true
+	return ch, append([]sseMessage(nil), h.recent...)
+}
+
+func (h *eventHub) unsubscribe(ch chan sseMessage) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.subs, ch)
+}
+
+// publishEvent forwards a session event to /api/events subscribers.
+func publishEvent(ev sessionEvent) {
+	if hub == nil {
+		return
+	}
+	if data, err := json.Marshal(ev); err == nil {
+		hub.publish(ev.Type, string(data))
+	}
+}
+
+// loopControl lets the HTTP API pause, resume and stop the main loop.
+// Pausing takes effect between iterations; stopping interrupts the running
+// aider and ends the loop.
+type loopControl struct {
+	mu        sync.Mutex
+	iteration int
+	paused    bool
+	stopping  bool
+	resumed   chan struct{}
+	stopAgent func() // interrupts the running aider (nil between iterations)
+}
+
+var control = &loopControl{}
+
+func (c *loopControl) setIteration(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.iteration = n
+}
+
+// setAgentStopper registers (or, with nil, clears) how to interrupt the
+// running aider.
+func (c *loopControl) setAgentStopper(stop func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stopAgent = stop
+}
+
+func (c *loopControl) pause() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.paused {
+		c.paused = true
+		c.resumed = make(chan struct{})
+	}
+}
+
+func (c *loopControl) resume() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.paused {
+		c.paused = false
+		close(c.resumed)
+	}
+}
+
+func (c *loopControl) stop() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stopping = true
+	if c.paused {
+		c.paused = false
+		close(c.resumed)
+	}
+	if c.stopAgent != nil {
+		go c.stopAgent()
+	}
+}
+
+func (c *loopControl) stopRequested() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stopping
+}
+
+// waitWhilePaused blocks while the loop is paused. It returns false if the
+// loop was stopped instead of resumed.
+func (c *loopControl) waitWhilePaused() bool {
+	c.mu.Lock()
+	paused, resumed := c.paused, c.resumed
+	c.mu.Unlock()
+	if paused {
+		logWarn("Loop paused via the HTTP API; waiting for resume")
+		<-resumed
+		if !c.stopRequested() {
+			logInfo("Loop resumed via the HTTP API")
+		}
+	}
+	return !c.stopRequested()
+}
+
+// state describes the loop for /api/status.
+func (c *loopControl) state() (iteration int, state string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch {
+	case c.stopping:
+		state = "stopping"
+	case c.paused:
+		state = "paused"
+	default:
+		state = "running"
+	}
+	return c.iteration, state
+}
+
+// statusResponse is the body of /api/status.
+type statusResponse struct {
+	Session        string             `json:"session"`
+	StartedAt      time.Time          `json:"started_at"`
+	State          string             `json:"state"` // running, paused, stopping or finished
+	Iteration      int                `json:"iteration"`
+	MaxIterations  int                `json:"max_iterations"`
+	Specs          *requirementCounts `json:"specs,omitempty"`
+	TokensSent     int                `json:"tokens_sent"`
+	TokensReceived int                `json:"tokens_received"`
+	Cost           float64            `json:"cost"`
+	Result         string             `json:"result,omitempty"`
+	ExitCode       int                `json:"exit_code"`
+	Iterations     []iterationRecord  `json:"iterations"`
+}
+
+func currentStatus() statusResponse {
+	iteration, state := control.state()
+	resp := statusResponse{State: state, Iteration: iteration, MaxIterations: config.MaxIterations, Iterations: []iterationRecord{}}
+	if session == nil {
+		return resp
+	}
+
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	resp.Session = session.ID
+	resp.StartedAt = session.StartedAt
+	resp.Specs = session.Requirements
+	resp.Iterations = append(resp.Iterations, session.Iterations...)
+	for _, rec := range session.Iterations {
+		resp.TokensSent += rec.TokensSent
+		resp.TokensReceived += rec.TokensReceived
+		resp.Cost += rec.Cost
+		if rec.Requirements != nil {
+			resp.Specs = rec.Requirements
+		}
+	}
+	if session.EndedAt != nil {
+		resp.State = "finished"
+		resp.Result = session.Result
+		resp.ExitCode = session.ExitCode
+	}
+	return resp
+}
+
+// serveToken returns the token the control endpoints require: --serve-token,
+// else $RALPH_SERVE_TOKEN, else a random one that is logged at startup.
+func serveToken() (token string, generated bool) {
+	if config.ServeToken != "" {
+		return config.ServeToken, false
+	}
+	if env := os.Getenv("RALPH_SERVE_TOKEN"); env != "" {
+		return env, false
+	}
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano()), true
+	}
+	return hex.EncodeToString(buf), true
+}
+
+// serveAddress is the address to listen on for --serve. The read endpoints
+// (/api/status, /api/events, /metrics) need no token and stream everything
+// aider prints, so an address without a host (":8080") binds to localhost
+// only; other interfaces must be asked for explicitly ("0.0.0.0:8080").
+func serveAddress(addr string) string {
+	if host, port, err := net.SplitHostPort(addr); err == nil && host == "" {
+		return net.JoinHostPort("127.0.0.1", port)
+	}
+	return addr
+}
+
+// startServer starts the HTTP status API and dashboard on config.Serve.
+func startServer() error {
+	listener, err := net.Listen("tcp", serveAddress(config.Serve))
+	if err != nil {
+		return fmt.Errorf("--serve: %v", err)
+	}
+	hub = &eventHub{subs: map[chan sseMessage]bool{}}
+	token, generated := serveToken()
+
+	authorized := func(r *http.Request) bool {
+		given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if given == "" {
+			given = r.Header.Get("X-Ralph-Token")
+		}
+		return subtle.ConstantTimeCompare([]byte(given), []byte(token)) == 1
+	}
+	controlHandler := func(action func(), message string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				http.Error(w, "POST required", http.StatusMethodNotAllowed)
+				return
+			}
+			if !authorized(r) {
+				http.Error(w, "missing or invalid token", http.StatusUnauthorized)
+				return
+			}
+			logWarn(fmt.Sprintf("%s via the HTTP API (%s)", message, r.RemoteAddr))
+			action()
+			writeJSON(w, currentStatus())
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, embeddedDashboard)
+	})
+	mux.HandleFunc("/api/status", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, currentStatus())
+	})
+	mux.HandleFunc("/api/events", serveEvents)
+	mux.HandleFunc("/metrics", serveMetrics)
+	mux.HandleFunc("/api/pause", controlHandler(control.pause, "Pause requested"))
+	mux.HandleFunc("/api/resume", controlHandler(control.resume, "Resume requested"))
+	mux.HandleFunc("/api/stop", controlHandler(control.stop, "Stop requested"))
+
+	go func() {
+		if err := http.Serve(listener, mux); err != nil {
+			logError(fmt.Sprintf("HTTP server stopped: %v", err))
+		}
+	}()
+
+	logInfo(fmt.Sprintf("Serving status API and dashboard on http://%s/", listener.Addr()))
+	if generated {
+		logInfo(fmt.Sprintf("Control token (pause/resume/stop): %s", token))
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+// serveEvents streams agent output and session events as Server-Sent Events.
+func serveEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	ch, recent := hub.subscribe()
+	defer hub.unsubscribe(ch)
+
+	write := func(msg sseMessage) {
+		fmt.Fprintf(w, "event: %s\n", msg.Event)
+		for _, line := range strings.Split(msg.Data, "\n") {
+			fmt.Fprintf(w, "data: %s\n", line)
+		}
+		fmt.Fprint(w, "\n")
+	}
+	for _, msg := range recent {
+		write(msg)
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(15 * time.Second)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case msg := <-ch:
+			write(msg)
+			flusher.Flush()
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		}
+	}
+}
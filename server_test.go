@@ -0,0 +1,59 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestServeAddress(t *testing.T) {
+	tests := map[string]string{
+		":8080":          "127.0.0.1:8080",
+		"0.0.0.0:8080":   "0.0.0.0:8080",
+		"127.0.0.1:9000": "127.0.0.1:9000",
+		"buildbox:8080":  "buildbox:8080",
+		"[::]:8080":      "[::]:8080",
+	}
+	for addr, want := range tests {
+		if got := serveAddress(addr); got != want {
+			t.Errorf("serveAddress(%q) = %q, want %q", addr, got, want)
+		}
+	}
+}
+
+func TestWaitForHumanInput(t *testing.T) {
+	defer func(c Config) { config = c }(config)
+	defer func(c *loopControl) { control = c }(control)
+	defer func(active bool) { loopActive = active }(loopActive)
+	defer func(d time.Duration) { answersPollInterval = d }(answersPollInterval)
+	answersPollInterval = 5 * time.Millisecond
+	loopActive = true
+
+	tests := []struct {
+		name   string
+		act    func()
+		answer bool
+	}{
+		{name: "answer arrives", act: func() { os.WriteFile(config.AnswersFile, []byte("use postgres\n"), 0644) }, answer: true},
+		{name: "stopped through the API", act: func() { control.stop() }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.AnswersFile = filepath.Join(t.TempDir(), "answers.md")
+			control = &loopControl{}
+			time.AfterFunc(20*time.Millisecond, tt.act)
+
+			done := make(chan bool)
+			go func() { done <- waitForHumanInput("which database?") }()
+			select {
+			case got := <-done:
+				if got != tt.answer {
+					t.Errorf("waitForHumanInput() = %v, want %v", got, tt.answer)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("waitForHumanInput() did not return")
+			}
+		})
+	}
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// requirement is one checkable item of the specs file: a "- [ ]" / "- [x]"
+// bullet in Markdown, or an object with a "completed" boolean in JSON.
+type requirement struct {
+	ID        string   // explicit id ({#id} annotation or JSON "id"), if any
+	DependsOn []string // ids of requirements that must be done first
+	Text      string
+	Section   string // heading (Markdown) or enclosing key/name (JSON) it belongs to
+	Line      int    // 1-based line in a Markdown specs file (0 for JSON)
+	Done      bool
+}
+
+// key identifies a requirement across iterations: its id if it has one,
+// otherwise its whitespace-normalised text.
+func (r requirement) key() string {
+	if r.ID != "" {
+		return "#" + r.ID
+	}
+	return strings.ToLower(strings.Join(strings.Fields(r.Text), " "))
+}
+
+var (
+	checkboxRe = regexp.MustCompile(`^\s*[-*+]\s+\[([ xX])\]\s+(.*?)\s*$`)
+	headingRe  = regexp.MustCompile(`^\s{0,3}(#{1,6})\s+(.*?)\s*#*\s*$`)
+
+	// annotationRe matches a trailing "{#id depends=a,b}" on a requirement;
+	// list values may have spaces after the commas ("depends=a, b").
+	annotationRe = regexp.MustCompile(`\s*\{#([A-Za-z0-9_.-]+)((?:\s+[A-Za-z_]+=[^\s},]*(?:\s*,\s*[^\s},]*)*)*)\s*\}\s*$`)
+	attributeRe  = regexp.MustCompile(`([A-Za-z_]+)=([^\s},]*(?:\s*,\s*[^\s},]*)*)`)
+)
+
+// jsonTextFields are tried in order for a JSON requirement's description.
+var jsonTextFields = []string{"description", "title", "name", "requirement", "text", "task", "id"}
+
+// parseSpecs extracts the requirements from the specs content, in document
+// order. JSON is detected by its first character; anything else is parsed
+// as Markdown.
+func parseSpecs(content string) ([]requirement, error) {
+	trimmed := strings.TrimSpace(content)
+	if strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[") {
+		return parseJSONSpecs(trimmed)
+	}
+	return parseMarkdownSpecs(content), nil
+}
+
+func parseMarkdownSpecs(content string) []requirement {
+	var reqs []requirement
+	section := ""
+	inFence := false
+	for i, line := range strings.Split(content, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			inFence = !inFence
+			continue
+		}
+		if inFence {
+			continue
+		}
+		if m := headingRe.FindStringSubmatch(line); m != nil {
+			section = m[2]
+			continue
+		}
+		if m := checkboxRe.FindStringSubmatch(line); m != nil {
+			r := requirement{
+				Text:    m[2],
+				Section: section,
+				Line:    i + 1,
+				Done:    m[1] != " ",
+			}
+			if a := annotationRe.FindStringSubmatch(r.Text); a != nil {
+				r.Text = r.Text[:len(r.Text)-len(a[0])]
+				r.ID = a[1]
+				for _, attr := range attributeRe.FindAllStringSubmatch(a[2], -1) {
+					if attr[1] == "depends" {
+						r.DependsOn = splitIDs(attr[2])
+					}
+				}
+			}
+			reqs = append(reqs, r)
+		}
+	}
+	return reqs
+}
+
+// jsonField is one member of a JSON object, kept in document order.
+type jsonField struct {
+	Key   string
+	Value interface{}
+}
+
+func parseJSONSpecs(content string) ([]requirement, error) {
+	dec := json.NewDecoder(strings.NewReader(content))
+	dec.UseNumber()
+	root, err := decodeOrderedJSON(dec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSON specs: %v", err)
+	}
+	var reqs []requirement
+	collectJSONRequirements(root, "", &reqs)
+	return reqs, nil
+}
+
+// decodeOrderedJSON decodes the next JSON value, representing objects as
+// []jsonField so the order of requirements is preserved.
+func decodeOrderedJSON(dec *json.Decoder) (interface{}, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch tok {
+	case json.Delim('{'):
+		var fields []jsonField
+		for dec.More() {
+			keyTok, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := decodeOrderedJSON(dec)
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, jsonField{Key: fmt.Sprint(keyTok), Value: value})
+		}
+		_, err := dec.Token()
+		return fields, err
+	case json.Delim('['):
+		var items []interface{}
+		for dec.More() {
+			value, err := decodeOrderedJSON(dec)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, value)
+		}
+		_, err := dec.Token()
+		return items, err
+	}
+	return tok, nil
+}
+
+// collectJSONRequirements walks the document: any object with a boolean
+// "completed" field is a requirement; other objects and arrays are searched,
+// with the key (or a "name"/"title" field) they sit under as the section.
+func collectJSONRequirements(node interface{}, section string, reqs *[]requirement) {
+	switch v := node.(type) {
+	case []interface{}:
+		for _, item := range v {
+			collectJSONRequirements(item, section, reqs)
+		}
+	case []jsonField:
+		if done, ok := jsonLookup(v, "completed").(bool); ok {
+			r := requirement{Section: section, Done: done}
+			if id, ok := jsonLookup(v, "id").(string); ok {
+				r.ID = id
+			}
+			for _, name := range []string{"depends", "depends_on"} {
+				switch deps := jsonLookup(v, name).(type) {
+				case string:
+					r.DependsOn = splitIDs(deps)
+				case []interface{}:
+					for _, d := range deps {
+						if s, ok := d.(string); ok {
+							r.DependsOn = append(r.DependsOn, splitIDs(s)...)
+						}
+					}
+				}
+			}
+			for _, name := range jsonTextFields {
+				if text, ok := jsonLookup(v, name).(string); ok && text != "" {
+					r.Text = text
+					break
+				}
+			}
+			*reqs = append(*reqs, r)
+			return
+		}
+		named := ""
+		if name, ok := jsonLookup(v, "name").(string); ok {
+			named = name
+		} else if title, ok := jsonLookup(v, "title").(string); ok {
+			named = title
+		}
+		for _, f := range v {
+			switch f.Value.(type) {
+			case []interface{}, []jsonField:
+				sub := f.Key
+				if named != "" {
+					sub = named
+				}
+				collectJSONRequirements(f.Value, sub, reqs)
+			}
+		}
+	}
+}
+
+// splitIDs splits a comma-separated list of requirement ids.
+func splitIDs(s string) []string {
+	var ids []string
+	for _, id := range strings.Split(s, ",") {
+		id = strings.TrimPrefix(strings.TrimSpace(id), "#")
+		if id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+func jsonLookup(fields []jsonField, key string) interface{} {
+	for _, f := range fields {
+		if f.Key == key {
+			return f.Value
+		}
+	}
+	return nil
+}
+
+// specsProgress counts the done and total requirements.
+func specsProgress(reqs []requirement) (done, total int) {
+	for _, r := range reqs {
+		if r.Done {
+			done++
+		}
+	}
+	return done, len(reqs)
+}
+
+// runSpecsCommand implements "aider-ralph specs <subcommand>".
+func runSpecsCommand(args []string) int {
+	if len(args) == 1 && args[0] == "lint" {
+		if !lintSpecsFile(config.SpecsFile) {
+			return 1
+		}
+		return 0
+	}
+	if len(args) == 0 || args[0] != "graph" {
+		fmt.Fprintf(os.Stderr, "%sUsage: aider-ralph specs graph [--specs PATH] [--format dot|mermaid]%s\n", colorRed, colorReset)
+		fmt.Fprintf(os.Stderr, "%s       aider-ralph specs lint [--specs PATH] [--strict] [--max-item-length N]%s\n", colorRed, colorReset)
+		return 1
+	}
+
+	g, err := loadSpecsGraph()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%sError: %v%s\n", colorRed, err, colorReset)
+		return 1
+	}
+	for i, deps := range g.Unknown {
+		fmt.Fprintf(os.Stderr, "%sWarning: %q depends on unknown id(s): %s%s\n", colorYellow, g.Reqs[i].Text, strings.Join(deps, ", "), colorReset)
+	}
+
+	switch config.GraphFormat {
+	case "dot":
+		fmt.Print(renderDOT(g))
+	case "mermaid":
+		fmt.Print(renderMermaid(g))
+	default:
+		fmt.Fprintf(os.Stderr, "%sError: invalid --format: %s (expected dot or mermaid)%s\n", colorRed, config.GraphFormat, colorReset)
+		return 1
+	}
+	return 0
+}
+
+// readRequirements parses the configured specs file.
+func readRequirements() ([]requirement, error) {
+	specs, err := getSpecs()
+	if err != nil {
+		return nil, err
+	}
+	return parseSpecs(specs)
+}
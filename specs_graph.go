@@ -0,0 +1,287 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// graphLabelLength caps requirement text in rendered graphs.
+const graphLabelLength = 60
+
+// specsGraph is the dependency graph between requirements, built from their
+// "{#id depends=a,b}" annotations (or JSON "id"/"depends_on" fields).
+type specsGraph struct {
+	Reqs    []requirement
+	byID    map[string]int
+	Unknown map[int][]string // dependencies on ids no requirement has, by requirement index
+}
+
+// buildSpecsGraph links requirements to their dependencies. Duplicate ids
+// and dependency cycles are errors; dependencies on unknown ids are
+// recorded in Unknown and otherwise ignored.
+func buildSpecsGraph(reqs []requirement) (*specsGraph, error) {
+	g := &specsGraph{Reqs: reqs, byID: map[string]int{}, Unknown: map[int][]string{}}
+	for i, r := range reqs {
+		if r.ID == "" {
+			continue
+		}
+		if j, ok := g.byID[r.ID]; ok {
+			return nil, fmt.Errorf("duplicate requirement id #%s (%q and %q)", r.ID, reqs[j].Text, r.Text)
+		}
+		g.byID[r.ID] = i
+	}
+	for i, r := range reqs {
+		for _, dep := range r.DependsOn {
+			if _, ok := g.byID[dep]; !ok {
+				g.Unknown[i] = append(g.Unknown[i], dep)
+			}
+		}
+	}
+	if cycle := g.findCycle(); cycle != nil {
+		return nil, fmt.Errorf("dependency cycle in specs: %s", strings.Join(cycle, " -> "))
+	}
+	return g, nil
+}
+
+// findCycle returns the ids along a dependency cycle, or nil if there is none.
+func (g *specsGraph) findCycle() []string {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make([]int, len(g.Reqs))
+	var path []string
+
+	var visit func(i int) []string
+	visit = func(i int) []string {
+		state[i] = visiting
+		path = append(path, g.Reqs[i].ID)
+		for _, dep := range g.Reqs[i].DependsOn {
+			j, ok := g.byID[dep]
+			if !ok {
+				continue
+			}
+			switch state[j] {
+			case visiting:
+				for k, id := range path {
+					if id == dep {
+						return append(append([]string{}, path[k:]...), dep)
+					}
+				}
+			case unvisited:
+				if cycle := visit(j); cycle != nil {
+					return cycle
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		state[i] = visited
+		return nil
+	}
+
+	for i := range g.Reqs {
+		if state[i] == unvisited {
+			if cycle := visit(i); cycle != nil {
+				return cycle
+			}
+		}
+	}
+	return nil
+}
+
+// hasDependencies reports whether any requirement declares dependencies.
+func (g *specsGraph) hasDependencies() bool {
+	for _, r := range g.Reqs {
+		if len(r.DependsOn) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// waitingOn lists the known dependencies of requirement i that are not done.
+func (g *specsGraph) waitingOn(i int) []string {
+	var ids []string
+	for _, dep := range g.Reqs[i].DependsOn {
+		if j, ok := g.byID[dep]; ok && !g.Reqs[j].Done {
+			ids = append(ids, dep)
+		}
+	}
+	return ids
+}
+
+// ready reports whether requirement i is unchecked with all dependencies done.
+func (g *specsGraph) ready(i int) bool {
+	return !g.Reqs[i].Done && len(g.waitingOn(i)) == 0
+}
+
+// counts returns how many requirements are done, ready and blocked.
+func (g *specsGraph) counts() (done, ready, blocked int) {
+	for i, r := range g.Reqs {
+		switch {
+		case r.Done:
+			done++
+		case g.ready(i):
+			ready++
+		default:
+			blocked++
+		}
+	}
+	return done, ready, blocked
+}
+
+// renderRequirementStatus is the body of the REQUIREMENT_STATUS prompt
+// section: which unchecked requirements are eligible and which must wait.
+func renderRequirementStatus(g *specsGraph) string {
+	var ready, blocked strings.Builder
+	for i, r := range g.Reqs {
+		if r.Done {
+			continue
+		}
+		if waiting := g.waitingOn(i); len(waiting) > 0 {
+			fmt.Fprintf(&blocked, "- %s (waiting on: %s)\n", requirementLabel(r), strings.Join(waiting, ", "))
+		} else {
+			fmt.Fprintf(&ready, "- %s\n", requirementLabel(r))
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString("Only READY requirements are eligible for this iteration. BLOCKED requirements depend on requirements that are not done yet; do not start them.\n\n")
+	b.WriteString("Ready:\n")
+	if ready.Len() == 0 {
+		b.WriteString("(none)\n")
+	}
+	b.WriteString(ready.String())
+	if blocked.Len() > 0 {
+		b.WriteString("\nBlocked:\n")
+		b.WriteString(blocked.String())
+	}
+	return b.String()
+}
+
+func requirementLabel(r requirement) string {
+	if r.ID == "" {
+		return r.Text
+	}
+	return "[#" + r.ID + "] " + r.Text
+}
+
+// loadSpecsGraph parses the specs file and builds its dependency graph.
+func loadSpecsGraph() (*specsGraph, error) {
+	reqs, err := readRequirements()
+	if err != nil {
+		return nil, err
+	}
+	return buildSpecsGraph(reqs)
+}
+
+// dotNodeName is the DOT node name of requirement i: its id, or "#N" for a
+// requirement without one (Markdown ids cannot contain "#"). Names are
+// always quoted, so any id is safe.
+func (g *specsGraph) dotNodeName(i int) string {
+	if id := g.Reqs[i].ID; id != "" {
+		return id
+	}
+	name := fmt.Sprintf("#%d", i+1)
+	for {
+		if _, taken := g.byID[name]; !taken {
+			return name
+		}
+		name += "'"
+	}
+}
+
+func dotQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// mermaidNodeID is the Mermaid node id of requirement i. Mermaid ids are
+// plain words, so an explicit id gets an "id_" prefix and every character
+// other than a letter or digit is hex-escaped ("a-b" → "id_a_2db", "a_b" →
+// "id_a_5fb"); requirements without an id are "req_N".
+func (g *specsGraph) mermaidNodeID(i int) string {
+	id := g.Reqs[i].ID
+	if id == "" {
+		return fmt.Sprintf("req_%d", i+1)
+	}
+	var b strings.Builder
+	b.WriteString("id_")
+	for j := 0; j < len(id); j++ {
+		c := id[j]
+		if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "_%02x", c)
+		}
+	}
+	return b.String()
+}
+
+// edges returns dependency edges as (dependency, dependent) index pairs.
+func (g *specsGraph) edges() [][2]int {
+	var edges [][2]int
+	for i, r := range g.Reqs {
+		for _, dep := range r.DependsOn {
+			if j, ok := g.byID[dep]; ok {
+				edges = append(edges, [2]int{j, i})
+			}
+		}
+	}
+	sort.SliceStable(edges, func(a, b int) bool { return edges[a][0] < edges[b][0] })
+	return edges
+}
+
+func graphLabel(r requirement) string {
+	text := r.Text
+	if len(text) > graphLabelLength {
+		text = firstBytes(text, graphLabelLength) + "..."
+	}
+	return text
+}
+
+// renderDOT renders the graph in Graphviz DOT.
+func renderDOT(g *specsGraph) string {
+	var b strings.Builder
+	b.WriteString("digraph specs {\n")
+	b.WriteString("  rankdir=LR;\n")
+	b.WriteString("  node [shape=box, style=\"rounded,filled\", fontname=\"Helvetica\"];\n")
+	for i, r := range g.Reqs {
+		color := "#e0e0e0" // blocked
+		if r.Done {
+			color = "#b7e4c7"
+		} else if g.ready(i) {
+			color = "#ffe8a3"
+		}
+		fmt.Fprintf(&b, "  %s [label=%s, fillcolor=\"%s\"];\n", dotQuote(g.dotNodeName(i)), dotQuote(graphLabel(r)), color)
+	}
+	for _, e := range g.edges() {
+		fmt.Fprintf(&b, "  %s -> %s;\n", dotQuote(g.dotNodeName(e[0])), dotQuote(g.dotNodeName(e[1])))
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// renderMermaid renders the graph as a Mermaid flowchart.
+func renderMermaid(g *specsGraph) string {
+	var b strings.Builder
+	b.WriteString("flowchart LR\n")
+	for i, r := range g.Reqs {
+		class := "blocked"
+		if r.Done {
+			class = "done"
+		} else if g.ready(i) {
+			class = "ready"
+		}
+		label := strings.ReplaceAll(graphLabel(r), `"`, "#quot;")
+		fmt.Fprintf(&b, "  %s[\"%s\"]:::%s\n", g.mermaidNodeID(i), label, class)
+	}
+	for _, e := range g.edges() {
+		fmt.Fprintf(&b, "  %s --> %s\n", g.mermaidNodeID(e[0]), g.mermaidNodeID(e[1]))
+	}
+	b.WriteString("  classDef done fill:#b7e4c7\n")
+	b.WriteString("  classDef ready fill:#ffe8a3\n")
+	b.WriteString("  classDef blocked fill:#e0e0e0\n")
+	return b.String()
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseMarkdownSpecsDependencies(t *testing.T) {
+	tests := []struct {
+		line    string
+		id      string
+		depends []string
+	}{
+		{"- [ ] API {#api depends=db,cache}", "api", []string{"db", "cache"}},
+		{"- [ ] API {#api depends=db, cache}", "api", []string{"db", "cache"}},
+		{"- [ ] API {#api depends=#db , #cache }", "api", []string{"db", "cache"}},
+		{"- [ ] API {#api}", "api", nil},
+		{"- [ ] API", "", nil},
+	}
+	for _, tt := range tests {
+		reqs := parseMarkdownSpecs(tt.line + "\n")
+		if len(reqs) != 1 {
+			t.Fatalf("parseMarkdownSpecs(%q) = %d requirements", tt.line, len(reqs))
+		}
+		r := reqs[0]
+		if r.Text != "API" || r.ID != tt.id || strings.Join(r.DependsOn, " ") != strings.Join(tt.depends, " ") {
+			t.Errorf("parseMarkdownSpecs(%q) = text %q, id %q, depends %q", tt.line, r.Text, r.ID, r.DependsOn)
+		}
+	}
+}
+
+func TestGraphNodeNamesAreDistinct(t *testing.T) {
+	g, err := buildSpecsGraph([]requirement{
+		{Text: "first"},
+		{Text: "second"},
+		{Text: "a-b", ID: "a-b"},
+		{Text: "a_b", ID: "a_b"},
+		{Text: "a.b", ID: "a.b"},
+		{Text: "r2", ID: "r2"},
+		{Text: "req_2", ID: "req_2"},
+		{Text: "id_a_2db", ID: "id_a_2db"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dot, mermaid := map[string]bool{}, map[string]bool{}
+	for i := range g.Reqs {
+		dot[g.dotNodeName(i)] = true
+		mermaid[g.mermaidNodeID(i)] = true
+	}
+	if len(dot) != len(g.Reqs) {
+		t.Errorf("DOT node names collide: %v", dot)
+	}
+	if len(mermaid) != len(g.Reqs) {
+		t.Errorf("Mermaid node ids collide: %v", mermaid)
+	}
+}
+
+func TestRenderDOTQuotesIDs(t *testing.T) {
+	g, err := buildSpecsGraph([]requirement{
+		{Text: `say "hi"`, ID: "db"},
+		{Text: "API", ID: "api", DependsOn: []string{"db"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := renderDOT(g)
+	for _, want := range []string{`"db" [label="say \"hi\""`, `"db" -> "api";`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("renderDOT() missing %q:\n%s", want, out)
+		}
+	}
+	if out := renderMermaid(g); !strings.Contains(out, "id_db --> id_api") {
+		t.Errorf("renderMermaid():\n%s", out)
+	}
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// defaultMaxItemLength is the longest requirement "specs lint" accepts
+// without a warning; longer items usually bundle several requirements.
+const defaultMaxItemLength = 300
+
+// Severities of lint findings. Errors fail the lint; warnings only fail it
+// with --strict.
+const (
+	lintError   = "error"
+	lintWarning = "warning"
+)
+
+// lintIssue is one finding of "specs lint".
+type lintIssue struct {
+	Line     int // 1-based line in the specs file (0 when not tied to a line)
+	Severity string
+	Message  string
+}
+
+var (
+	bulletRe       = regexp.MustCompile(`^( ?)[-*+]\s+\S|^( ?)\d+[.)]\s+\S`)
+	placeholderRe  = regexp.MustCompile(`(?i)^(goal|requirement|task|feature)\s+\d+$`)
+	thematicRe     = regexp.MustCompile(`^\s{0,3}([-*_])(\s*([-*_]))*\s*$`)
+	requirementsRe = regexp.MustCompile(`(?i)requirement|goal|task|feature|todo|milestone|backlog`)
+)
+
+// specsSection is a Markdown heading and what lint saw beneath it.
+type specsSection struct {
+	Title      string
+	Level      int
+	Line       int
+	HasContent bool // any text besides blank lines, comments and rules
+	Checkboxes int
+	Bullets    []int // lines of top-level bullets that are not checkboxes
+}
+
+// lintSpecs checks the specs content for problems that waste iterations:
+// placeholders, duplicates, items the loop cannot track and dependency
+// errors. Issues are returned in line order.
+func lintSpecs(content string, maxItemLength int) []lintIssue {
+	var issues []lintIssue
+	add := func(line int, severity, format string, args ...interface{}) {
+		issues = append(issues, lintIssue{Line: line, Severity: severity, Message: fmt.Sprintf(format, args...)})
+	}
+
+	reqs, err := parseSpecs(content)
+	if err != nil {
+		add(0, lintError, "%v", err)
+		return issues
+	}
+	isJSON := strings.HasPrefix(strings.TrimSpace(content), "{") || strings.HasPrefix(strings.TrimSpace(content), "[")
+
+	if len(reqs) == 0 {
+		if isJSON {
+			add(0, lintError, "no requirements found (expected objects with a boolean \"completed\" field)")
+		} else {
+			add(0, lintError, "no requirements found (expected \"- [ ]\" checkbox items)")
+		}
+	}
+
+	seen := map[string]requirement{}
+	for _, r := range reqs {
+		text := strings.TrimSpace(r.Text)
+		switch {
+		case text == "":
+			add(r.Line, lintError, "requirement has no text")
+			continue
+		case placeholderRe.MatchString(text):
+			add(r.Line, lintError, "placeholder requirement %q left from init", text)
+		case len(text) > maxItemLength:
+			add(r.Line, lintWarning, "requirement is %d characters long (max %d); split it into smaller items", len(text), maxItemLength)
+		}
+
+		norm := strings.ToLower(strings.Join(strings.Fields(text), " "))
+		if first, ok := seen[norm]; ok {
+			if first.Line > 0 {
+				add(r.Line, lintError, "duplicate requirement %q (first on line %d)", text, first.Line)
+			} else {
+				add(r.Line, lintError, "duplicate requirement %q", text)
+			}
+			continue
+		}
+		seen[norm] = r
+	}
+
+	if g, err := buildSpecsGraph(reqs); err != nil {
+		add(0, lintError, "%v", err)
+	} else {
+		for i, deps := range g.Unknown {
+			add(g.Reqs[i].Line, lintWarning, "%q depends on unknown id(s): %s", g.Reqs[i].Text, strings.Join(deps, ", "))
+		}
+	}
+
+	if !isJSON {
+		issues = append(issues, lintMarkdownStructure(content)...)
+		if !mentionsCompletionSignal(content) {
+			add(0, lintWarning, "no completion-signal instructions (expected %s)", completionSignalExample())
+		}
+	}
+
+	sort.SliceStable(issues, func(i, j int) bool { return issues[i].Line < issues[j].Line })
+	return issues
+}
+
+// lintMarkdownStructure flags empty sections, leftover HTML comments and
+// plain bullets in requirement sections, which the loop cannot check off.
+func lintMarkdownStructure(content string) []lintIssue {
+	var issues []lintIssue
+	var sections []*specsSection
+	var current *specsSection
+	inFence, inComment := false, false
+
+	for i, line := range strings.Split(content, "\n") {
+		trimmed := strings.TrimSpace(line)
+
+		if inComment {
+			if strings.Contains(trimmed, "-->") {
+				inComment = false
+			}
+			continue
+		}
+		if strings.HasPrefix(trimmed, "```") {
+			inFence = !inFence
+		}
+		if inFence || strings.HasPrefix(trimmed, "```") {
+			if current != nil {
+				current.HasContent = true
+			}
+			continue
+		}
+
+		if m := headingRe.FindStringSubmatch(line); m != nil {
+			current = &specsSection{Title: m[2], Level: len(m[1]), Line: i + 1}
+			sections = append(sections, current)
+			continue
+		}
+
+		if strings.HasPrefix(trimmed, "<!--") {
+			issues = append(issues, lintIssue{Line: i + 1, Severity: lintWarning, Message: "HTML comment left from the init template"})
+			if !strings.Contains(trimmed, "-->") {
+				inComment = true
+			} else if rest := trimmed[strings.Index(trimmed, "-->")+3:]; strings.TrimSpace(rest) != "" && current != nil {
+				current.HasContent = true
+			}
+			continue
+		}
+
+		if trimmed == "" || thematicRe.MatchString(line) || current == nil {
+			continue
+		}
+		current.HasContent = true
+		if checkboxRe.MatchString(line) {
+			current.Checkboxes++
+		} else if bulletRe.MatchString(line) {
+			current.Bullets = append(current.Bullets, i+1)
+		}
+	}
+
+	for i, s := range sections {
+		if !s.HasContent && (i+1 == len(sections) || sections[i+1].Level <= s.Level) {
+			issues = append(issues, lintIssue{Line: s.Line, Severity: lintWarning, Message: fmt.Sprintf("section %q is empty", s.Title)})
+		}
+		if s.Checkboxes > 0 || requirementsRe.MatchString(s.Title) {
+			for _, line := range s.Bullets {
+				issues = append(issues, lintIssue{Line: line, Severity: lintWarning, Message: fmt.Sprintf("bullet in requirement section %q is not a checkbox; the loop only tracks \"- [ ]\" items", s.Title)})
+			}
+		}
+	}
+	return issues
+}
+
+// mentionsCompletionSignal reports whether the specs tell the agent how to
+// signal completion.
+func mentionsCompletionSignal(content string) bool {
+	if config.CompletionTag != "" && config.CompletionValue != "" {
+		if strings.Contains(content, "<"+config.CompletionTag+">") && strings.Contains(content, config.CompletionValue) {
+			return true
+		}
+	}
+	return config.CompletionPromise != "" && strings.Contains(content, config.CompletionPromise)
+}
+
+func completionSignalExample() string {
+	if config.CompletionTag != "" && config.CompletionValue != "" {
+		return fmt.Sprintf("<%s>%s</%s>", config.CompletionTag, config.CompletionValue, config.CompletionTag)
+	}
+	return config.CompletionPromise
+}
+
+// lintFailed reports whether issues should fail the lint.
+func lintFailed(issues []lintIssue) bool {
+	for _, issue := range issues {
+		if issue.Severity == lintError || config.LintStrict {
+			return true
+		}
+	}
+	return false
+}
+
+// printLintIssues prints issues compiler-style ("SPECS.md:12: error: ...")
+// followed by a summary line.
+func printLintIssues(file string, issues []lintIssue) {
+	errors, warnings := 0, 0
+	for _, issue := range issues {
+		color := colorYellow
+		if issue.Severity == lintError {
+			color = colorRed
+			errors++
+		} else {
+			warnings++
+		}
+		location := file
+		if issue.Line > 0 {
+			location = fmt.Sprintf("%s:%d", file, issue.Line)
+		}
+		fmt.Printf("%s: %s%s%s: %s\n", location, color, issue.Severity, colorReset, issue.Message)
+	}
+	if len(issues) == 0 {
+		fmt.Printf("%s%s: no problems found%s\n", colorGreen, file, colorReset)
+		return
+	}
+	fmt.Printf("%s: %d error(s), %d warning(s)\n", file, errors, warnings)
+}
+
+// lintSpecsFile lints one specs file and prints the findings. It returns
+// false if the lint fails.
+func lintSpecsFile(file string) bool {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		fmt.Printf("%s: %serror%s: %v\n", file, colorRed, colorReset, err)
+		return false
+	}
+	issues := lintSpecs(string(data), config.MaxItemLength)
+	printLintIssues(file, issues)
+	return !lintFailed(issues)
+}
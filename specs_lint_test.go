@@ -0,0 +1,129 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestLintSpecs(t *testing.T) {
+	defer func(c Config) { config = c }(config)
+	config.CompletionTag, config.CompletionValue = defaultCompletionTag, defaultCompletionValue
+
+	const signal = "\nSay <ralph_status>COMPLETED</ralph_status> when done.\n"
+	tests := []struct {
+		name    string
+		content string
+		want    []string // "line: severity: message substring", in order
+	}{
+		{
+			name:    "clean",
+			content: "# Specs\n\n## Requirements\n- [ ] Add a login page\n- [x] Set up the project\n" + signal,
+		},
+		{
+			name:    "no requirements",
+			content: "# Specs\n\nNothing here yet.\n" + signal,
+			want:    []string{`0: error: no requirements found (expected "- [ ]" checkbox items)`},
+		},
+		{
+			name:    "json without requirements",
+			content: `{"goals": [{"text": "a"}]}`,
+			want:    []string{`0: error: no requirements found (expected objects with a boolean "completed" field)`},
+		},
+		{
+			name:    "placeholder and duplicate",
+			content: "## Goals\n- [ ] Goal 1\n- [ ] Add   search\n- [ ] add search\n" + signal,
+			want: []string{
+				`2: error: placeholder requirement "Goal 1" left from init`,
+				`4: error: duplicate requirement "add search" (first on line 3)`,
+			},
+		},
+		{
+			name:    "item too long",
+			content: "## Requirements\n- [ ] " + strings.Repeat("word ", 61) + "\n" + signal,
+			want:    []string{"2: warning: requirement is 304 characters long (max 300)"},
+		},
+		{
+			name:    "item exactly at the limit",
+			content: "## Requirements\n- [ ] " + strings.Repeat("x", 300) + "\n" + signal,
+		},
+		{
+			name:    "plain bullet in a requirement section",
+			content: "## Requirements\n- [ ] Real item\n- not tracked\n  - nested detail is fine\n" + signal,
+			want:    []string{`3: warning: bullet in requirement section "Requirements" is not a checkbox`},
+		},
+		{
+			name:    "bullets elsewhere are fine",
+			content: "## Background\n- some context\n\n## Requirements\n- [ ] Real item\n" + signal,
+		},
+		{
+			name:    "empty section and leftover comment",
+			content: "## Requirements\n- [ ] Real item\n\n## Notes\n\n## Later\n<!-- list more here -->\n" + signal,
+			want: []string{
+				`4: warning: section "Notes" is empty`,
+				"7: warning: HTML comment left from the init template",
+			},
+		},
+		{
+			name:    "section with only subsections is not empty",
+			content: "## Requirements\n### Part A\n- [ ] Item\n" + signal,
+		},
+		{
+			name:    "fenced code counts as content",
+			content: "## Requirements\n- [ ] Item\n## Example\n```\n- not a bullet\n```\n" + signal,
+		},
+		{
+			name:    "unknown dependency",
+			content: "## Requirements\n- [ ] API {#api depends=db}\n" + signal,
+			want:    []string{`2: warning: "API" depends on unknown id(s): db`},
+		},
+		{
+			name:    "dependency cycle",
+			content: "## Requirements\n- [ ] A {#a depends=b}\n- [ ] B {#b depends=a}\n" + signal,
+			want:    []string{"0: error: dependency cycle in specs: a -> b -> a"},
+		},
+		{
+			name:    "duplicate id",
+			content: "## Requirements\n- [ ] A {#a}\n- [ ] B {#a}\n" + signal,
+			want:    []string{`0: error: duplicate requirement id #a ("A" and "B")`},
+		},
+		{
+			name:    "no completion signal",
+			content: "## Requirements\n- [ ] Item\n",
+			want:    []string{"0: warning: no completion-signal instructions (expected <ralph_status>COMPLETED</ralph_status>)"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			issues := lintSpecs(tt.content, defaultMaxItemLength)
+			var got []string
+			for _, issue := range issues {
+				got = append(got, strings.Join([]string{strconv.Itoa(issue.Line), issue.Severity, issue.Message}, ": "))
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("lintSpecs() =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+			for i := range got {
+				if !strings.HasPrefix(got[i], tt.want[i]) {
+					t.Errorf("issue %d = %q, want prefix %q", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestLintFailed(t *testing.T) {
+	defer func(c Config) { config = c }(config)
+
+	warnings := []lintIssue{{Severity: lintWarning}}
+	errors := []lintIssue{{Severity: lintWarning}, {Severity: lintError}}
+
+	config.LintStrict = false
+	if lintFailed(nil) || lintFailed(warnings) || !lintFailed(errors) {
+		t.Error("without --strict only errors should fail the lint")
+	}
+	config.LintStrict = true
+	if lintFailed(nil) || !lintFailed(warnings) {
+		t.Error("with --strict warnings should fail the lint")
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ralphDir is the per-project working directory used by aider-ralph.
+const ralphDir = ".ralph"
+
+// sessionsDir holds one sub-directory of state per run.
+var sessionsDir = filepath.Join(ralphDir, "sessions")
+
+// iterationRecord is what aider-ralph remembers about one iteration.
+type iterationRecord struct {
+	Iteration       int            `json:"iteration"`
+	Kind            string         `json:"kind,omitempty"` // "" for a normal iteration, "audit" for a completion audit
+	StartedAt       time.Time      `json:"started_at"`
+	EndedAt         time.Time      `json:"ended_at"`
+	DurationSeconds float64        `json:"duration_seconds"`
+	Task            string         `json:"task,omitempty"` // requirement given by the driver (--task-mode=driver)
+	Model           string         `json:"model,omitempty"`
+	AgentExitCode   *int           `json:"agent_exit_code,omitempty"` // nil if aider did not run
+	Outcome         string         `json:"outcome"`
+	Status          string         `json:"status,omitempty"`
+	StatusReason    string         `json:"status_reason,omitempty"`
+	Termination     string         `json:"termination,omitempty"` // how aider ended once it reported a status
+	ReadError       string         `json:"read_error,omitempty"`  // reading aider's output failed part way
+	Verify          []verifyResult `json:"verify,omitempty"`
+	Hooks           []hookResult   `json:"hooks,omitempty"` // pre- and post-iteration hooks
+
+	Coverage *coverageMeasurement `json:"coverage,omitempty"` // --coverage-cmd after the iteration
+
+	Requirements   *requirementCounts `json:"requirements,omitempty"` // specs progress after the iteration
+	Completed      []string           `json:"completed,omitempty"`    // requirements checked during the iteration
+	Reopened       []string           `json:"reopened,omitempty"`     // requirements unchecked during the iteration
+	TokensSent     int                `json:"tokens_sent,omitempty"`
+	TokensReceived int                `json:"tokens_received,omitempty"`
+	Cost           float64            `json:"cost,omitempty"` // USD, as reported by aider
+}
+
+// sessionState is persisted to .ralph/sessions/<id>/state.json after every
+// iteration so a run can be inspected while (and after) it executes.
+type sessionState struct {
+	ID         string            `json:"id"`
+	StartedAt  time.Time         `json:"started_at"`
+	EndedAt    *time.Time        `json:"ended_at,omitempty"`
+	Iterations []iterationRecord `json:"iterations"`
+	Result     string            `json:"result,omitempty"`
+	ExitCode   int               `json:"exit_code"`
+
+	Requirements     *requirementCounts   `json:"requirements,omitempty"`      // specs progress when the run started
+	CoverageBaseline *coverageMeasurement `json:"coverage_baseline,omitempty"` // --coverage-cmd before the first iteration
+
+	requirements []requirement // specs as of the last recorded iteration
+	mu           sync.Mutex    // guards the state while the HTTP API (--serve) reads it
+}
+
+// session is the state of the current run (nil outside the main loop).
+var session *sessionState
+
+func newSessionID() string {
+	return time.Now().Format("20060102-150405")
+}
+
+func newSession() *sessionState {
+	return &sessionState{
+		ID:         newSessionID(),
+		StartedAt:  time.Now(),
+		Iterations: []iterationRecord{},
+	}
+}
+
+func (s *sessionState) dir() string {
+	return filepath.Join(sessionsDir, s.ID)
+}
+
+func (s *sessionState) save() error {
+	if config.DryRun {
+		return nil
+	}
+	if err := os.MkdirAll(s.dir(), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(s.dir(), "state.json"), append(data, '\n'), 0644)
+}
+
+func (s *sessionState) record(rec iterationRecord) {
+	s.mu.Lock()
+	s.trackProgress(&rec)
+	s.Iterations = append(s.Iterations, rec)
+	if err := s.save(); err != nil {
+		logWarn(fmt.Sprintf("Failed to save session state: %v", err))
+	}
+	s.mu.Unlock()
+	endIterationSpan(rec)
+	for _, text := range rec.Completed {
+		s.emit(sessionEvent{Type: eventRequirementDone, Iteration: rec.Iteration, Message: text})
+	}
+	s.emit(sessionEvent{Type: eventIterationEnded, Iteration: rec.Iteration, Outcome: rec.Outcome, Status: rec.Status, Message: rec.StatusReason})
+}
+
+func (s *sessionState) finish(result string, exitCode int) {
+	s.mu.Lock()
+	now := time.Now()
+	s.EndedAt = &now
+	s.Result = result
+	s.ExitCode = exitCode
+	if err := s.save(); err != nil {
+		logWarn(fmt.Sprintf("Failed to save session state: %v", err))
+	}
+	s.mu.Unlock()
+	endTracing(result, exitCode)
+	s.emit(sessionEvent{Type: eventSessionEnded, Outcome: result, Message: fmt.Sprintf("exit code %d", exitCode)})
+}
+
+// lastRecord returns the most recent iteration record, if any.
+func (s *sessionState) lastRecord() *iterationRecord {
+	if len(s.Iterations) == 0 {
+		return nil
+	}
+	return &s.Iterations[len(s.Iterations)-1]
+}
+
+// loadSession reads the state of a previous run. An empty id selects the
+// most recent session.
+func loadSession(id string) (*sessionState, error) {
+	return loadSessionFrom(sessionsDir, id)
+}
+
+// loadSessionFrom is loadSession for the sessions directory dir.
+func loadSessionFrom(dir, id string) (*sessionState, error) {
+	if id == "" {
+		ids, err := listSessionIDsIn(dir)
+		if err != nil {
+			return nil, err
+		}
+		if len(ids) == 0 {
+			return nil, fmt.Errorf("no sessions found in %s", dir)
+		}
+		id = ids[len(ids)-1]
+	}
+	data, err := os.ReadFile(filepath.Join(dir, id, "state.json"))
+	if err != nil {
+		return nil, err
+	}
+	s := &sessionState{}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("invalid state for session %s: %v", id, err)
+	}
+	return s, nil
+}
+
+// listSessionIDs returns the recorded session IDs, oldest first.
+func listSessionIDs() ([]string, error) {
+	return listSessionIDsIn(sessionsDir)
+}
+
+func listSessionIDsIn(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var ids []string
+	for _, e := range entries {
+		if e.IsDir() && fileExists(filepath.Join(dir, e.Name(), "state.json")) {
+			ids = append(ids, e.Name())
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
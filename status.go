@@ -0,0 +1,235 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Status values the agent may report inside the completion tag. The
+// completion value itself (COMPLETED by default) is configurable.
+const (
+	statusCompleted  = "COMPLETED"
+	statusBlocked    = "BLOCKED"
+	statusNeedsInput = "NEEDS_INPUT"
+	statusInProgress = "IN_PROGRESS"
+	statusFailed     = "FAILED"
+)
+
+// Loop actions a status can map to.
+const (
+	actionContinue = "continue"
+	actionStop     = "stop"
+	actionPause    = "pause"
+)
+
+// statusAction is what the loop does when an iteration reports a status.
+type statusAction struct {
+	Action   string
+	ExitCode int
+}
+
+// Exit codes used by the default status actions, and for a completion
+// --confirm-completion had no iteration left to audit.
+const (
+	exitBlocked   = 2
+	exitFailed    = 3
+	exitUnaudited = 4
+)
+
+func defaultStatusActions() map[string]statusAction {
+	return map[string]statusAction{
+		statusCompleted:  {Action: actionStop, ExitCode: 0},
+		statusBlocked:    {Action: actionStop, ExitCode: exitBlocked},
+		statusNeedsInput: {Action: actionPause},
+		statusInProgress: {Action: actionContinue},
+		statusFailed:     {Action: actionContinue, ExitCode: exitFailed},
+	}
+}
+
+var knownStatuses = []string{statusCompleted, statusBlocked, statusNeedsInput, statusInProgress, statusFailed}
+
+// defaultAnswersFile is where a human answers a NEEDS_INPUT question.
+var defaultAnswersFile = filepath.Join(ralphDir, "answers.md")
+
+// answersPollInterval is how often a paused loop checks the answers file.
+var answersPollInterval = 2 * time.Second
+
+// parseStatusAction parses an --on-status value: STATUS=ACTION[:EXIT_CODE].
+func parseStatusAction(value string) (string, statusAction, error) {
+	name, spec, ok := strings.Cut(value, "=")
+	if !ok {
+		return "", statusAction{}, fmt.Errorf("invalid --on-status %q (expected STATUS=ACTION[:EXIT_CODE])", value)
+	}
+	name = strings.ToUpper(strings.TrimSpace(name))
+	known := false
+	for _, s := range knownStatuses {
+		if s == name {
+			known = true
+		}
+	}
+	if !known {
+		return "", statusAction{}, fmt.Errorf("unknown status %q in --on-status (expected one of %s)", name, strings.Join(knownStatuses, ", "))
+	}
+
+	// Without an explicit code the status keeps its default one, so
+	// BLOCKED=stop still exits 2 and FAILED=stop exits 3
+	action, code, hasCode := strings.Cut(strings.TrimSpace(spec), ":")
+	sa := defaultStatusActions()[name]
+	sa.Action = strings.ToLower(action)
+	if sa.Action != actionContinue && sa.Action != actionStop && sa.Action != actionPause {
+		return "", statusAction{}, fmt.Errorf("unknown action %q in --on-status (expected continue, stop or pause)", action)
+	}
+	if hasCode {
+		n, err := strconv.Atoi(strings.TrimSpace(code))
+		if err != nil || n < 0 {
+			return "", statusAction{}, fmt.Errorf("invalid exit code %q in --on-status", code)
+		}
+		sa.ExitCode = n
+	}
+	return name, sa, nil
+}
+
+// completionSignal is the completion signal the agent must output, as
+// prompt templates show it: the configured tag and value, or the legacy
+// completion promise.
+func completionSignal() string {
+	if config.CompletionTag != "" && config.CompletionValue != "" {
+		return fmt.Sprintf("<%s>\n%s\n</%s>", config.CompletionTag, config.CompletionValue, config.CompletionTag)
+	}
+	return config.CompletionPromise
+}
+
+// expandCompletionPlaceholders fills in {{COMPLETION_SIGNAL}},
+// {{COMPLETION_TAG}} and {{COMPLETION_VALUE}} in a prompt template, so
+// templates follow --completion-tag and --completion-value.
+func expandCompletionPlaceholders(template string) string {
+	return strings.NewReplacer(
+		"{{COMPLETION_SIGNAL}}", completionSignal(),
+		"{{COMPLETION_TAG}}", config.CompletionTag,
+		"{{COMPLETION_VALUE}}", config.CompletionValue,
+	).Replace(template)
+}
+
+// extractStatus returns the value and optional reason of the last status tag
+// in the output. The first line of the tag body is the value; anything after
+// it (or after a ":" on the same line) is the reason.
+func extractStatus(output string) (string, string) {
+	if config.CompletionTag == "" {
+		return "", ""
+	}
+	tag := regexp.QuoteMeta(config.CompletionTag)
+	re := regexp.MustCompile(fmt.Sprintf(`(?s)<%s>\s*(.*?)\s*</%s>`, tag, tag))
+	matches := re.FindAllStringSubmatch(output, -1)
+	if len(matches) == 0 {
+		return "", ""
+	}
+	body := strings.TrimSpace(matches[len(matches)-1][1])
+	first, rest, _ := strings.Cut(body, "\n")
+	value, inline, _ := strings.Cut(first, ":")
+	value = strings.ToUpper(strings.TrimSpace(value))
+	reason := strings.TrimSpace(strings.TrimSpace(inline) + "\n" + strings.TrimSpace(rest))
+
+	if value == strings.ToUpper(config.CompletionValue) {
+		value = statusCompleted
+	}
+	return value, reason
+}
+
+// statusOutcome is the outcome recorded for an iteration reporting status.
+func statusOutcome(status string) string {
+	if status == "" {
+		return "no_status"
+	}
+	return strings.ToLower(status)
+}
+
+// actionForStatus looks up the configured loop action for a status.
+// Unknown statuses continue the loop.
+func actionForStatus(status string) statusAction {
+	if sa, ok := config.StatusActions[status]; ok {
+		return sa
+	}
+	return statusAction{Action: actionContinue}
+}
+
+// getHumanAnswers returns the contents of the answers file, if any.
+func getHumanAnswers() (string, error) {
+	if config.AnswersFile == "" {
+		return "", nil
+	}
+	data, err := os.ReadFile(config.AnswersFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// pendingQuestion returns the reason of the most recent NEEDS_INPUT status.
+func pendingQuestion() string {
+	if session == nil {
+		return ""
+	}
+	for i := len(session.Iterations) - 1; i >= 0; i-- {
+		rec := session.Iterations[i]
+		if rec.Status == statusNeedsInput {
+			return rec.StatusReason
+		}
+	}
+	return ""
+}
+
+// consumeHumanAnswers moves the answers that were injected into an
+// iteration's prompt into the notes (so they persist) and removes the
+// answers file so they are only injected once.
+func consumeHumanAnswers(iteration int, answers string) {
+	if answers == "" || config.DryRun {
+		return
+	}
+	entry := "Answer:\n" + answers + "\n"
+	if q := pendingQuestion(); q != "" {
+		entry = "Question:\n" + q + "\n\n" + entry
+	}
+	if err := appendNotesEntry(fmt.Sprintf("Human input (given to iteration %d)", iteration), entry); err != nil {
+		logWarn(fmt.Sprintf("Failed to record human input in notes: %v", err))
+	}
+	if err := os.Remove(config.AnswersFile); err != nil && !os.IsNotExist(err) {
+		logWarn(fmt.Sprintf("Failed to remove answers file: %v", err))
+	}
+}
+
+// waitForHumanInput pauses the loop until the answers file has content.
+// It returns false if the loop was stopped while waiting, by a signal or
+// through the HTTP API (--serve).
+func waitForHumanInput(question string) bool {
+	fmt.Println()
+	fmt.Print("\a")
+	logWarn("The agent needs input from a human to continue.")
+	if question != "" {
+		fmt.Printf("%sQuestion:%s\n%s\n\n", colorYellow, colorReset, question)
+	}
+	logInfo(fmt.Sprintf("Write your answer to %s; the loop resumes when it has content.", config.AnswersFile))
+
+	if dir := filepath.Dir(config.AnswersFile); dir != "." && dir != "" {
+		_ = os.MkdirAll(dir, 0755)
+	}
+
+	for loopActive && !control.stopRequested() {
+		answers, err := getHumanAnswers()
+		if err != nil {
+			logWarn(fmt.Sprintf("Failed to read answers file: %v", err))
+		} else if answers != "" {
+			logOK("Answer received, resuming loop")
+			return true
+		}
+		time.Sleep(answersPollInterval)
+	}
+	return false
+}
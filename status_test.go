@@ -0,0 +1,137 @@
+package main
+
+import "testing"
+
+func TestParseStatusAction(t *testing.T) {
+	tests := []struct {
+		value   string
+		name    string
+		want    statusAction
+		wantErr bool
+	}{
+		{value: "FAILED=stop", name: statusFailed, want: statusAction{Action: actionStop, ExitCode: exitFailed}},
+		{value: "blocked=stop", name: statusBlocked, want: statusAction{Action: actionStop, ExitCode: exitBlocked}},
+		{value: "FAILED=stop:4", name: statusFailed, want: statusAction{Action: actionStop, ExitCode: 4}},
+		{value: "COMPLETED=stop", name: statusCompleted, want: statusAction{Action: actionStop}},
+		{value: "BLOCKED=Pause", name: statusBlocked, want: statusAction{Action: actionPause, ExitCode: exitBlocked}},
+		{value: " in_progress = continue ", name: statusInProgress, want: statusAction{Action: actionContinue}},
+		{value: "NEEDS_INPUT=stop:0", name: statusNeedsInput, want: statusAction{Action: actionStop}},
+		{value: "FAILED", wantErr: true},
+		{value: "DONE=stop", wantErr: true},
+		{value: "FAILED=explode", wantErr: true},
+		{value: "FAILED=", wantErr: true},
+		{value: "FAILED=stop:x", wantErr: true},
+		{value: "FAILED=stop:4x", wantErr: true},
+		{value: "FAILED=stop:-1", wantErr: true},
+	}
+	for _, tt := range tests {
+		name, got, err := parseStatusAction(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseStatusAction(%q) error = %v, want error %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if name != tt.name || got != tt.want {
+			t.Errorf("parseStatusAction(%q) = %q, %+v, want %q, %+v", tt.value, name, got, tt.name, tt.want)
+		}
+	}
+}
+
+func TestExtractStatus(t *testing.T) {
+	defer func(c Config) { config = c }(config)
+
+	tests := []struct {
+		name       string
+		tag, value string
+		output     string
+		status     string
+		reason     string
+	}{
+		{
+			name:   "completed",
+			output: "<ralph_status>\nCOMPLETED\n</ralph_status>",
+			status: statusCompleted,
+		},
+		{
+			name:   "single line, lower case",
+			output: "done <ralph_status>blocked</ralph_status>",
+			status: statusBlocked,
+		},
+		{
+			name:   "inline reason",
+			output: "<ralph_status>BLOCKED: the API key is missing</ralph_status>",
+			status: statusBlocked,
+			reason: "the API key is missing",
+		},
+		{
+			name:   "multi-line reason",
+			output: "<ralph_status>\nNEEDS_INPUT\nWhich database should we use?\nPostgres or SQLite.\n</ralph_status>",
+			status: statusNeedsInput,
+			reason: "Which database should we use?\nPostgres or SQLite.",
+		},
+		{
+			name:   "inline and multi-line reason",
+			output: "<ralph_status>FAILED: tests broken\nsee the log\n</ralph_status>",
+			status: statusFailed,
+			reason: "tests broken\nsee the log",
+		},
+		{
+			name:   "last tag wins",
+			output: "<ralph_status>IN_PROGRESS</ralph_status>\nmore work\n<ralph_status>\nFAILED\n</ralph_status>\n",
+			status: statusFailed,
+		},
+		{
+			name:   "custom completion value",
+			value:  "ALL_DONE",
+			output: "<ralph_status>all_done</ralph_status>",
+			status: statusCompleted,
+		},
+		{
+			name:   "custom tag",
+			tag:    "loop_state",
+			output: "<ralph_status>BLOCKED</ralph_status>\n<loop_state>IN_PROGRESS</loop_state>",
+			status: statusInProgress,
+		},
+		{
+			name:   "unclosed tag",
+			output: "<ralph_status>\nCOMPLETED\n",
+		},
+		{
+			name:   "no tag configured",
+			tag:    "-",
+			output: "<ralph_status>COMPLETED</ralph_status>",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.CompletionTag, config.CompletionValue = defaultCompletionTag, defaultCompletionValue
+			if tt.tag == "-" {
+				config.CompletionTag = ""
+			} else if tt.tag != "" {
+				config.CompletionTag = tt.tag
+			}
+			if tt.value != "" {
+				config.CompletionValue = tt.value
+			}
+			status, reason := extractStatus(tt.output)
+			if status != tt.status || reason != tt.reason {
+				t.Errorf("extractStatus() = %q, %q, want %q, %q", status, reason, tt.status, tt.reason)
+			}
+		})
+	}
+}
+
+func TestActionForStatus(t *testing.T) {
+	defer func(c Config) { config = c }(config)
+	config.StatusActions = defaultStatusActions()
+	config.StatusActions[statusFailed] = statusAction{Action: actionStop, ExitCode: 4}
+
+	if got := actionForStatus(statusFailed); got != (statusAction{Action: actionStop, ExitCode: 4}) {
+		t.Errorf("actionForStatus(FAILED) = %+v", got)
+	}
+	if got := actionForStatus(statusBlocked); got != (statusAction{Action: actionStop, ExitCode: exitBlocked}) {
+		t.Errorf("actionForStatus(BLOCKED) = %+v", got)
+	}
+	if got := actionForStatus("WHATEVER"); got != (statusAction{Action: actionContinue}) {
+		t.Errorf("actionForStatus(unknown) = %+v", got)
+	}
+}
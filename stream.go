@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"strings"
+)
+
+// streamReadSize is how much agent output is read per call.
+const streamReadSize = 32 * 1024
+
+// maxPartialCheck bounds the incomplete tail handed to onPartial; prompts
+// are short, and huge unterminated lines (minified diffs) are not prompts.
+const maxPartialCheck = 4096
+
+// streamLines reads r until EOF, copying the raw bytes to display as they
+// arrive and calling onLine for every line, however long, including a final
+// line without a trailing newline. After each read, onPartial (if set) gets
+// the incomplete tail so prompts that never end in a newline can be spotted.
+//
+// Read errors other than EOF (or a closed pty) are returned, after draining
+// r so the agent can never block on a full pipe.
+func streamLines(r io.Reader, display io.Writer, onLine func(string), onPartial func(string)) error {
+	buf := make([]byte, streamReadSize)
+	var pending []byte
+
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			if display != nil {
+				display.Write(buf[:n])
+			}
+			pending = append(pending, buf[:n]...)
+
+			start := 0
+			for {
+				i := bytes.IndexByte(pending[start:], '\n')
+				if i < 0 {
+					break
+				}
+				onLine(string(pending[start : start+i]))
+				start += i + 1
+			}
+			pending = append(pending[:0], pending[start:]...)
+
+			if onPartial != nil && len(pending) > 0 && len(pending) <= maxPartialCheck {
+				onPartial(string(pending))
+			}
+		}
+
+		if err != nil {
+			if len(pending) > 0 {
+				onLine(string(pending))
+			}
+			if err == io.EOF || isPTYClosed(err) {
+				return nil
+			}
+			_, _ = io.Copy(io.Discard, r)
+			return err
+		}
+	}
+}
+
+// detectorWindow is how much recent output the streamDetector keeps; a
+// status block larger than this is still found after the run.
+const detectorWindow = 64 * 1024
+
+// streamDetector watches agent output line by line for the status tag, so
+// a status is noticed as soon as it is complete even when the tag is split
+// across reads or lines.
+type streamDetector struct {
+	window strings.Builder
+
+	Status       string // last status seen so far ("" if none)
+	StatusReason string
+
+	// onStatus, if set, is called each time a complete status tag arrives.
+	onStatus func(status, reason string)
+}
+
+func (d *streamDetector) feed(line string) {
+	d.window.WriteString(line)
+	d.window.WriteString("\n")
+	if d.window.Len() > detectorWindow {
+		tail := d.window.String()[d.window.Len()-detectorWindow/2:]
+		d.window.Reset()
+		d.window.WriteString(tail)
+	}
+
+	if config.CompletionTag != "" && strings.Contains(line, "</"+config.CompletionTag+">") {
+		if status, reason := extractStatus(d.window.String()); status != "" {
+			d.Status, d.StatusReason = status, reason
+			if d.onStatus != nil {
+				d.onStatus(status, reason)
+			}
+		}
+	}
+	if config.CompletionPromise != "" && d.Status == "" && strings.Contains(line, config.CompletionPromise) {
+		d.Status = statusCompleted
+		if d.onStatus != nil {
+			d.onStatus(d.Status, "")
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+// chunkReader returns its content at most n bytes per Read, then err (or
+// io.EOF), then whatever follows in rest.
+type chunkReader struct {
+	data string
+	n    int
+	err  error
+	rest string
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	if r.data == "" {
+		if r.err != nil {
+			err := r.err
+			r.err, r.data = nil, r.rest
+			return 0, err
+		}
+		return 0, io.EOF
+	}
+	n := r.n
+	if n > len(p) {
+		n = len(p)
+	}
+	if n > len(r.data) {
+		n = len(r.data)
+	}
+	copy(p, r.data[:n])
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func TestStreamLines(t *testing.T) {
+	long := strings.Repeat("x", 1500*1024)
+	tests := []struct {
+		name     string
+		input    string
+		chunk    int
+		lines    []string
+		partials []string // onPartial calls, in order
+	}{
+		{
+			name:  "whole lines",
+			input: "one\ntwo\n",
+			chunk: 1024,
+			lines: []string{"one", "two"},
+		},
+		{
+			name:     "lines split across reads",
+			input:    "first line\nsecond\n",
+			chunk:    3,
+			lines:    []string{"first line", "second"},
+			partials: []string{"fir", "first ", "first lin", "s", "seco"},
+		},
+		{
+			name:     "partial last line at EOF",
+			input:    "done\nAdd file to the chat? (Y)es/(N)o [Yes]: ",
+			chunk:    1024,
+			lines:    []string{"done", "Add file to the chat? (Y)es/(N)o [Yes]: "},
+			partials: []string{"Add file to the chat? (Y)es/(N)o [Yes]: "},
+		},
+		{
+			name:  "line over 1MB",
+			input: "before\n" + long + "\nafter\n",
+			chunk: streamReadSize,
+			lines: []string{"before", long, "after"},
+		},
+		{
+			name:     "empty lines",
+			input:    "\n\na\n",
+			chunk:    1,
+			lines:    []string{"", "", "a"},
+			partials: []string{"a"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var display strings.Builder
+			var lines, partials []string
+			err := streamLines(&chunkReader{data: tt.input, n: tt.chunk}, &display,
+				func(line string) { lines = append(lines, line) },
+				func(tail string) { partials = append(partials, tail) })
+			if err != nil {
+				t.Fatalf("streamLines() error = %v", err)
+			}
+			if display.String() != tt.input {
+				t.Errorf("display got %d bytes, want %d", display.Len(), len(tt.input))
+			}
+			if strings.Join(lines, "|") != strings.Join(tt.lines, "|") {
+				t.Errorf("lines = %d %.80q, want %d %.80q", len(lines), lines, len(tt.lines), tt.lines)
+			}
+			if strings.Join(partials, "|") != strings.Join(tt.partials, "|") {
+				t.Errorf("partials = %q, want %q", partials, tt.partials)
+			}
+		})
+	}
+}
+
+func TestStreamLinesSkipsHugePartials(t *testing.T) {
+	var partials int
+	input := strings.Repeat("y", maxPartialCheck+1)
+	if err := streamLines(strings.NewReader(input), nil, func(string) {}, func(string) { partials++ }); err != nil {
+		t.Fatal(err)
+	}
+	if partials != 0 {
+		t.Errorf("onPartial called %d times for a %d byte tail", partials, len(input))
+	}
+}
+
+func TestStreamLinesReadError(t *testing.T) {
+	boom := errors.New("read failed")
+	r := &chunkReader{data: "a\nb", n: 1024, err: boom, rest: strings.Repeat("z", 100*1024)}
+	var lines []string
+	err := streamLines(r, nil, func(line string) { lines = append(lines, line) }, nil)
+	if !errors.Is(err, boom) {
+		t.Errorf("streamLines() error = %v, want %v", err, boom)
+	}
+	if strings.Join(lines, "|") != "a|b" {
+		t.Errorf("lines = %q, want the pending partial line flushed", lines)
+	}
+	if r.data != "" {
+		t.Errorf("%d bytes left unread after the error", len(r.data))
+	}
+
+	if err := streamLines(iotest.ErrReader(boom), nil, func(string) {}, nil); !errors.Is(err, boom) {
+		t.Errorf("streamLines(ErrReader) error = %v", err)
+	}
+}
+
+func TestStreamDetector(t *testing.T) {
+	defer func(c Config) { config = c }(config)
+
+	tests := []struct {
+		name       string
+		tag, value string
+		promise    string
+		output     string
+		chunk      int
+		status     string
+		reason     string
+		calls      int
+	}{
+		{
+			name:   "tag split across reads",
+			tag:    defaultCompletionTag,
+			value:  defaultCompletionValue,
+			output: "working\n<ralph_status>\nBLOCKED\nneeds a database\n</ralph_status>\n",
+			chunk:  4,
+			status: statusBlocked,
+			reason: "needs a database",
+			calls:  1,
+		},
+		{
+			name:   "tag split inside a line",
+			tag:    defaultCompletionTag,
+			value:  defaultCompletionValue,
+			output: "<ralph_sta" + "tus>COMPLETED</ralph_st" + "atus>\n",
+			chunk:  7,
+			status: statusCompleted,
+			calls:  1,
+		},
+		{
+			name:   "last tag wins",
+			tag:    defaultCompletionTag,
+			value:  defaultCompletionValue,
+			output: "<ralph_status>IN_PROGRESS</ralph_status>\nmore work\n<ralph_status>\nCOMPLETED\n</ralph_status>\n",
+			chunk:  16,
+			status: statusCompleted,
+			calls:  2,
+		},
+		{
+			name:   "status after lots of output",
+			tag:    defaultCompletionTag,
+			value:  defaultCompletionValue,
+			output: strings.Repeat("some output line\n", 10000) + "<ralph_status>\nFAILED: tests broken\n</ralph_status>\n",
+			chunk:  streamReadSize,
+			status: statusFailed,
+			reason: "tests broken",
+			calls:  1,
+		},
+		{
+			name:    "completion promise",
+			promise: "ALL DONE",
+			output:  "finished\nALL DONE\nALL DONE again\n",
+			chunk:   5,
+			status:  statusCompleted,
+			calls:   1,
+		},
+		{
+			name:   "tag in a file listing is not a status",
+			tag:    defaultCompletionTag,
+			value:  defaultCompletionValue,
+			output: "no status here\n</other>\n",
+			chunk:  8,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.CompletionTag, config.CompletionValue, config.CompletionPromise = tt.tag, tt.value, tt.promise
+			calls := 0
+			d := &streamDetector{onStatus: func(string, string) { calls++ }}
+			if err := streamLines(&chunkReader{data: tt.output, n: tt.chunk}, nil, d.feed, nil); err != nil {
+				t.Fatal(err)
+			}
+			if d.Status != tt.status || d.StatusReason != tt.reason || calls != tt.calls {
+				t.Errorf("status %q, reason %q, %d calls; want %q, %q, %d calls", d.Status, d.StatusReason, calls, tt.status, tt.reason, tt.calls)
+			}
+		})
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Ways of choosing the requirement an iteration works on (--task-mode).
+const (
+	taskModeSelf   = "self"   // the model picks one itself (PROMPT.md self-prioritisation)
+	taskModeDriver = "driver" // aider-ralph picks the next unchecked requirement
+)
+
+// defaultTaskMaxAttempts is how many failed iterations a requirement gets
+// in driver mode before it is skipped.
+const defaultTaskMaxAttempts = 3
+
+// tasksFile tracks per-requirement attempts across iterations and runs.
+var tasksFile = filepath.Join(ralphDir, "tasks.json")
+
+// taskState is the driver's record of one requirement.
+type taskState struct {
+	Text          string `json:"text"`
+	Attempts      int    `json:"attempts"`
+	Failures      int    `json:"failures"`
+	Done          bool   `json:"done,omitempty"`
+	Skipped       bool   `json:"skipped,omitempty"`
+	LastIteration int    `json:"last_iteration,omitempty"`
+	LastOutcome   string `json:"last_outcome,omitempty"`
+}
+
+// taskQueue is the content of .ralph/tasks.json, keyed by requirement.key().
+type taskQueue struct {
+	Tasks map[string]*taskState `json:"tasks"`
+}
+
+// taskAssignment is what the driver gave the running iteration: a
+// requirement, or nil when every requirement is already checked.
+type taskAssignment struct {
+	Req *requirement
+}
+
+// currentTask is set while a driver-mode iteration runs (nil otherwise) and
+// adds the CURRENT_TASK section to its prompt.
+var currentTask *taskAssignment
+
+// selectTask picks the requirement for the next driver-mode iteration.
+func selectTask() (task *requirement, exhausted bool, err error) {
+	reqs, err := readRequirements()
+	if err != nil {
+		return nil, false, err
+	}
+	q, err := loadTaskQueue()
+	if err != nil {
+		return nil, false, err
+	}
+	task, exhausted = nextTask(reqs, q)
+	return task, exhausted, nil
+}
+
+func loadTaskQueue() (*taskQueue, error) {
+	q := &taskQueue{Tasks: map[string]*taskState{}}
+	data, err := os.ReadFile(tasksFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return q, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(data, q); err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", tasksFile, err)
+	}
+	if q.Tasks == nil {
+		q.Tasks = map[string]*taskState{}
+	}
+	return q, nil
+}
+
+func (q *taskQueue) save() error {
+	if config.DryRun {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(tasksFile), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(q, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(tasksFile, append(data, '\n'), 0644)
+}
+
+func (q *taskQueue) state(r requirement) *taskState {
+	t, ok := q.Tasks[r.key()]
+	if !ok {
+		t = &taskState{Text: r.Text}
+		q.Tasks[r.key()] = t
+	}
+	return t
+}
+
+// nextTask picks the first unchecked requirement, in specs order, that has
+// not been skipped and whose dependencies are done. It returns nil if there
+// is none; exhausted is true when unchecked requirements remain but none of
+// them is eligible.
+func nextTask(reqs []requirement, q *taskQueue) (task *requirement, exhausted bool) {
+	g, err := buildSpecsGraph(reqs)
+	if err != nil {
+		logWarn(fmt.Sprintf("Ignoring requirement dependencies: %v", err))
+		g = nil
+	}
+	for i := range reqs {
+		r := reqs[i]
+		if r.Done {
+			continue
+		}
+		if t, ok := q.Tasks[r.key()]; ok && t.Skipped {
+			exhausted = true
+			continue
+		}
+		if g != nil && !g.ready(i) {
+			exhausted = true
+			continue
+		}
+		return &r, false
+	}
+	return nil, exhausted
+}
+
+// recordTaskAttempt updates the queue after an iteration worked on task:
+// it is done once checked in the specs; otherwise the attempt failed unless
+// the agent reported IN_PROGRESS. After config.TaskMaxAttempts failures the
+// requirement is skipped.
+func recordTaskAttempt(task *requirement, rec iterationRecord) {
+	q, err := loadTaskQueue()
+	if err != nil {
+		logWarn(fmt.Sprintf("Failed to load task queue: %v", err))
+		return
+	}
+	t := q.state(*task)
+	t.Attempts++
+	t.LastIteration = rec.Iteration
+	t.LastOutcome = rec.Outcome
+
+	done := false
+	if reqs, err := readRequirements(); err == nil {
+		for _, r := range reqs {
+			if r.key() == task.key() {
+				done = r.Done
+				break
+			}
+		}
+	}
+
+	switch {
+	case done:
+		t.Done = true
+		logOK(fmt.Sprintf("Requirement done after %d attempt(s): %s", t.Attempts, task.Text))
+	case rec.Status == statusInProgress:
+		logInfo(fmt.Sprintf("Requirement in progress (attempt %d): %s", t.Attempts, task.Text))
+	default:
+		t.Failures++
+		if t.Failures >= config.TaskMaxAttempts {
+			t.Skipped = true
+			logWarn(fmt.Sprintf("Skipping requirement after %d failed attempt(s): %s", t.Failures, task.Text))
+			note := fmt.Sprintf("- Skipped after %d failed attempts: %s\n- Remove its entry from %s to retry it.", t.Failures, task.Text, filepath.ToSlash(tasksFile))
+			if err := appendNotesEntry(fmt.Sprintf("Iteration %d (requirement skipped)", rec.Iteration), note); err != nil {
+				logWarn(fmt.Sprintf("Failed to append notes: %v", err))
+			}
+		} else {
+			logWarn(fmt.Sprintf("Requirement not done (failed attempt %d of %d): %s", t.Failures, config.TaskMaxAttempts, task.Text))
+		}
+	}
+
+	if err := q.save(); err != nil {
+		logWarn(fmt.Sprintf("Failed to save task queue: %v", err))
+	}
+}
+
+// renderCurrentTask is the body of the CURRENT_TASK prompt section.
+func renderCurrentTask(task *requirement) string {
+	if task == nil {
+		return "None: every requirement in SPECS is marked complete. Verify that this is true and, if so, output the completion signal.\n"
+	}
+
+	var b strings.Builder
+	b.WriteString("The loop driver has selected the ONE requirement for this iteration. Work on this requirement only; skip the self-prioritisation steps and do not choose another.\n\n")
+	fmt.Fprintf(&b, "Requirement: %s\n", task.Text)
+	if task.Section != "" {
+		fmt.Fprintf(&b, "Section: %s\n", task.Section)
+	}
+	if task.Line > 0 {
+		fmt.Fprintf(&b, "SPECS line: %d\n", task.Line)
+	}
+	if q, err := loadTaskQueue(); err == nil {
+		if t, ok := q.Tasks[task.key()]; ok && t.Attempts > 0 {
+			fmt.Fprintf(&b, "Previous attempts: %d (%d failed; it is skipped after %d failures). Check PRIOR_NOTES for what went wrong.\n", t.Attempts, t.Failures, config.TaskMaxAttempts)
+		}
+	}
+	b.WriteString("\nWhen it is fully implemented, mark it complete in SPECS.\n")
+	return b.String()
+}
@@ -0,0 +1,372 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// traceExportTimeout bounds each POST to --trace-endpoint.
+const traceExportTimeout = 5 * time.Second
+
+// span is one timed operation of a trace. A nil *span is a no-op, so call
+// sites need not check whether tracing is enabled.
+type span struct {
+	TraceID    string
+	SpanID     string
+	ParentID   string
+	Name       string
+	Start      time.Time
+	End        time.Time
+	Attributes map[string]interface{}
+	Failed     bool
+	Message    string // status message when Failed
+}
+
+// set adds an attribute (string, bool, int or float64).
+func (s *span) set(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.Attributes[key] = value
+}
+
+// fail marks the span's status as an error.
+func (s *span) fail(message string) {
+	if s == nil {
+		return
+	}
+	s.Failed = true
+	s.Message = message
+}
+
+// end finishes the span. Spans are exported in batches: an iteration with
+// its child spans, then the session span when the run ends.
+func (s *span) end() {
+	if s == nil || tracer == nil {
+		return
+	}
+	tracer.finish(s)
+}
+
+// traceRecorder builds the span tree (session → iteration → prompt, agent,
+// verify and git spans) and exports it as OTLP/JSON.
+type traceRecorder struct {
+	mu        sync.Mutex
+	traceID   string
+	session   *span
+	iteration *span
+	stack     []*span // open spans, innermost last
+	done      []*span // finished spans not yet exported
+	warned    bool
+}
+
+// tracer is nil unless --trace-file or --trace-endpoint is given.
+var tracer *traceRecorder
+
+func randomHex(n int) string {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Sprintf("%0*x", n*2, time.Now().UnixNano())
+	}
+	return hex.EncodeToString(buf)
+}
+
+// startTracing starts the session span if tracing is configured.
+func startTracing(sessionID string) {
+	if config.TraceFile == "" && config.TraceEndpoint == "" {
+		return
+	}
+	tracer = &traceRecorder{traceID: randomHex(16)}
+	tracer.session = startSpan("session")
+	tracer.session.set("ralph.session", sessionID)
+	tracer.session.set("ralph.specs_file", config.SpecsFile)
+	tracer.session.set("ralph.max_iterations", config.MaxIterations)
+}
+
+// endTracing finishes the session span and exports what is left.
+func endTracing(result string, exitCode int) {
+	if tracer == nil {
+		return
+	}
+	s := tracer.session
+	s.set("ralph.result", result)
+	s.set("ralph.exit_code", exitCode)
+	if exitCode != 0 {
+		s.fail(result)
+	}
+	tracer.mu.Lock()
+	for len(tracer.stack) > 0 {
+		open := tracer.stack[len(tracer.stack)-1]
+		tracer.mu.Unlock()
+		open.end()
+		tracer.mu.Lock()
+	}
+	tracer.mu.Unlock()
+	tracer.export()
+}
+
+// startSpan opens a span as a child of the innermost open span.
+func startSpan(name string) *span {
+	if tracer == nil {
+		return nil
+	}
+	tracer.mu.Lock()
+	defer tracer.mu.Unlock()
+	s := &span{TraceID: tracer.traceID, SpanID: randomHex(8), Name: name, Start: time.Now(), Attributes: map[string]interface{}{}}
+	if n := len(tracer.stack); n > 0 {
+		s.ParentID = tracer.stack[n-1].SpanID
+	}
+	tracer.stack = append(tracer.stack, s)
+	return s
+}
+
+// beginIterationSpan opens the span of iteration n; session.record ends it.
+func beginIterationSpan(n int) {
+	if tracer == nil {
+		return
+	}
+	s := startSpan(fmt.Sprintf("iteration %d", n))
+	s.set("ralph.iteration", n)
+	tracer.mu.Lock()
+	tracer.iteration = s
+	tracer.mu.Unlock()
+}
+
+// endIterationSpan ends the open iteration span with rec's attributes and
+// exports it with its children.
+func endIterationSpan(rec iterationRecord) {
+	if tracer == nil {
+		return
+	}
+	tracer.mu.Lock()
+	s := tracer.iteration
+	tracer.iteration = nil
+	tracer.mu.Unlock()
+	if s == nil {
+		return
+	}
+	if rec.Kind != "" {
+		s.set("ralph.kind", rec.Kind)
+	}
+	s.set("ralph.outcome", rec.Outcome)
+	if rec.Status != "" {
+		s.set("ralph.status", rec.Status)
+	}
+	if rec.Model != "" {
+		s.set("gen_ai.request.model", rec.Model)
+	}
+	if rec.Task != "" {
+		s.set("ralph.task", rec.Task)
+	}
+	if rec.TokensSent > 0 || rec.TokensReceived > 0 {
+		s.set("gen_ai.usage.input_tokens", rec.TokensSent)
+		s.set("gen_ai.usage.output_tokens", rec.TokensReceived)
+	}
+	if rec.Cost > 0 {
+		s.set("ralph.cost_usd", rec.Cost)
+	}
+	if len(rec.Completed) > 0 {
+		s.set("ralph.requirements_completed", len(rec.Completed))
+	}
+	if iterationFailed(rec.Outcome) || rec.Outcome == "blocked" {
+		s.fail(rec.Outcome)
+	}
+	s.end()
+	tracer.export()
+}
+
+// endAgentSpan ends the span of an aider run with its result.
+func endAgentSpan(s *span, r agentResult) {
+	if s == nil {
+		return
+	}
+	if r.Err != nil {
+		s.fail(r.Err.Error())
+	} else {
+		s.set("process.exit.code", r.ExitCode)
+		s.set("ralph.agent.timed_out", r.TimedOut)
+		if r.Termination != "" {
+			s.set("ralph.agent.termination", r.Termination)
+		}
+		if r.Prompt != "" {
+			s.set("ralph.agent.interactive_prompt", r.Prompt)
+		}
+		if r.TimedOut || r.Prompt != "" {
+			s.fail("aider was killed")
+		}
+	}
+	s.end()
+}
+
+// endVerifySpan ends the span of one verification command with its result.
+func endVerifySpan(s *span, r verifyResult) {
+	if s == nil {
+		return
+	}
+	s.set("ralph.verify.command", r.Command)
+	s.set("process.exit.code", r.ExitCode)
+	s.set("ralph.verify.passed", r.Passed)
+	s.set("ralph.verify.timed_out", r.TimedOut)
+	if !r.Passed {
+		s.fail(fmt.Sprintf("exit code %d", r.ExitCode))
+	}
+	s.end()
+}
+
+// finish closes s (and any spans left open inside it).
+func (t *traceRecorder) finish(s *span) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !s.End.IsZero() {
+		return
+	}
+	for i := len(t.stack) - 1; i >= 0; i-- {
+		if t.stack[i] != s {
+			continue
+		}
+		for _, inner := range t.stack[i+1:] {
+			inner.End = time.Now()
+			t.done = append(t.done, inner)
+		}
+		t.stack = t.stack[:i]
+		break
+	}
+	s.End = time.Now()
+	t.done = append(t.done, s)
+}
+
+// export writes the finished spans to the trace file and/or endpoint.
+func (t *traceRecorder) export() {
+	t.mu.Lock()
+	spans := t.done
+	t.done = nil
+	t.mu.Unlock()
+	if len(spans) == 0 {
+		return
+	}
+
+	data, err := json.Marshal(otlpTraceRequest(spans))
+	if err != nil {
+		return
+	}
+	if config.TraceFile != "" {
+		f, err := os.OpenFile(config.TraceFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err == nil {
+			_, err = f.Write(append(data, '\n'))
+			f.Close()
+		}
+		if err != nil {
+			t.warnOnce(fmt.Sprintf("Failed to write trace file: %v", err))
+		}
+	}
+	if config.TraceEndpoint != "" {
+		if err := postTraces(traceEndpointURL(config.TraceEndpoint), data); err != nil {
+			t.warnOnce(fmt.Sprintf("Failed to export traces: %v", err))
+		}
+	}
+}
+
+func (t *traceRecorder) warnOnce(message string) {
+	t.mu.Lock()
+	warned := t.warned
+	t.warned = true
+	t.mu.Unlock()
+	if !warned {
+		logWarn(message)
+	}
+}
+
+// traceEndpointURL adds the OTLP/HTTP traces path to a bare collector
+// address ("http://localhost:4318" → ".../v1/traces").
+func traceEndpointURL(endpoint string) string {
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "http://" + endpoint
+	}
+	rest := endpoint[strings.Index(endpoint, "://")+3:]
+	if !strings.Contains(strings.TrimSuffix(rest, "/"), "/") {
+		endpoint = strings.TrimSuffix(endpoint, "/") + "/v1/traces"
+	}
+	return endpoint
+}
+
+func postTraces(url string, body []byte) error {
+	client := &http.Client{Timeout: traceExportTimeout}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s: %s", url, resp.Status)
+	}
+	return nil
+}
+
+// otlpTraceRequest renders spans as an OTLP/JSON ExportTraceServiceRequest.
+func otlpTraceRequest(spans []*span) map[string]interface{} {
+	var out []map[string]interface{}
+	for _, s := range spans {
+		o := map[string]interface{}{
+			"traceId":           s.TraceID,
+			"spanId":            s.SpanID,
+			"name":              s.Name,
+			"kind":              1, // SPAN_KIND_INTERNAL
+			"startTimeUnixNano": strconv.FormatInt(s.Start.UnixNano(), 10),
+			"endTimeUnixNano":   strconv.FormatInt(s.End.UnixNano(), 10),
+			"attributes":        otlpAttributes(s.Attributes),
+			"status":            map[string]interface{}{"code": 1}, // STATUS_CODE_OK
+		}
+		if s.ParentID != "" {
+			o["parentSpanId"] = s.ParentID
+		}
+		if s.Failed {
+			o["status"] = map[string]interface{}{"code": 2, "message": s.Message} // STATUS_CODE_ERROR
+		}
+		out = append(out, o)
+	}
+	return map[string]interface{}{
+		"resourceSpans": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{
+				"attributes": otlpAttributes(map[string]interface{}{"service.name": "aider-ralph", "service.version": version}),
+			},
+			"scopeSpans": []interface{}{map[string]interface{}{
+				"scope": map[string]interface{}{"name": "aider-ralph", "version": version},
+				"spans": out,
+			}},
+		}},
+	}
+}
+
+func otlpAttributes(attrs map[string]interface{}) []interface{} {
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	out := []interface{}{}
+	for _, k := range keys {
+		var value map[string]interface{}
+		switch v := attrs[k].(type) {
+		case bool:
+			value = map[string]interface{}{"boolValue": v}
+		case int:
+			value = map[string]interface{}{"intValue": strconv.Itoa(v)}
+		case float64:
+			value = map[string]interface{}{"doubleValue": v}
+		default:
+			value = map[string]interface{}{"stringValue": fmt.Sprint(v)}
+		}
+		out = append(out, map[string]interface{}{"key": k, "value": value})
+	}
+	return out
+}
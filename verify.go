@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// verifyOutputTail caps how much of a failing verify command's output is
+// shown and written to the notes.
+const verifyOutputTail = 4000
+
+// verifyResult is the outcome of one --verify command.
+type verifyResult struct {
+	Command         string  `json:"command"`
+	ExitCode        int     `json:"exit_code"`
+	Passed          bool    `json:"passed"`
+	DurationSeconds float64 `json:"duration_seconds"`
+	TimedOut        bool    `json:"timed_out,omitempty"`
+
+	Output string `json:"-"`
+}
+
+// shellCommand runs command through the platform shell.
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.CommandContext(ctx, "cmd", "/C", command)
+	}
+	return exec.CommandContext(ctx, "sh", "-c", command)
+}
+
+// runVerifyCommands runs every --verify command in order (all of them, even
+// after a failure, so the report is complete) and reports whether all passed.
+// Output goes to logWriter; a failing command's output is also shown.
+func runVerifyCommands(logWriter io.Writer) ([]verifyResult, bool) {
+	var results []verifyResult
+	passed := true
+	for _, command := range config.Verify {
+		inject, command := parseInjectPrefix("verify", command)
+		commandSpan := startSpan("verify command")
+		r := runVerifyCommand(command)
+		endVerifySpan(commandSpan, r)
+		results = append(results, r)
+		if inject != "" {
+			injectOutput(inject, r)
+		}
+
+		if logWriter != nil {
+			fmt.Fprintf(logWriter, "=== Verify: %s (exit %d) ===\n%s\n", command, r.ExitCode, r.Output)
+		}
+		if r.Passed {
+			logOK(fmt.Sprintf("Verify passed: %s (%.1fs)", command, r.DurationSeconds))
+			continue
+		}
+
+		passed = false
+		if r.TimedOut {
+			logError(fmt.Sprintf("Verify timed out after %ds: %s", config.Timeout, command))
+		} else {
+			logError(fmt.Sprintf("Verify failed (exit %d): %s", r.ExitCode, command))
+		}
+		if out := tailText(r.Output, verifyOutputTail); out != "" {
+			fmt.Println(out)
+		}
+	}
+	return results, passed
+}
+
+func runVerifyCommand(command string) verifyResult {
+	return runShellCommand(command, nil)
+}
+
+// runShellCommand runs command through the shell with env (nil: aider-ralph's
+// own environment), capturing its output, bounded by --timeout.
+func runShellCommand(command string, env []string) verifyResult {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(config.Timeout)*time.Second)
+	defer cancel()
+
+	var out bytes.Buffer
+	cmd := shellCommand(ctx, command)
+	cmd.Env = env
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+
+	start := time.Now()
+	err := cmd.Run()
+	r := verifyResult{
+		Command:         command,
+		DurationSeconds: time.Since(start).Seconds(),
+		Output:          stripANSI(out.String()),
+	}
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		r.TimedOut = true
+		r.ExitCode = -1
+	case err != nil:
+		r.ExitCode = -1
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			r.ExitCode = exitErr.ExitCode()
+		} else {
+			r.Output += err.Error() + "\n"
+		}
+	default:
+		r.Passed = true
+	}
+	return r
+}
+
+// verifyFailureNotes summarises failed verify commands for the notes file,
+// so the next iteration knows what to fix.
+func verifyFailureNotes(results []verifyResult) string {
+	var b strings.Builder
+	for _, r := range results {
+		if r.Passed {
+			continue
+		}
+		if r.TimedOut {
+			fmt.Fprintf(&b, "- `%s` timed out after %ds\n", r.Command, config.Timeout)
+		} else {
+			fmt.Fprintf(&b, "- `%s` failed (exit %d)\n", r.Command, r.ExitCode)
+		}
+		if out := tailText(r.Output, verifyOutputTail); out != "" {
+			fmt.Fprintf(&b, "\n```\n%s\n```\n\n", out)
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// tailText returns the last max bytes of s (starting on a line boundary
+// where possible), trimmed.
+func tailText(s string, max int) string {
+	s = strings.TrimSpace(s)
+	if len(s) <= max {
+		return s
+	}
+	s = s[len(s)-max:]
+	if i := strings.IndexByte(s, '\n'); i >= 0 && i < len(s)-1 {
+		s = s[i+1:]
+	}
+	return "... (truncated)\n" + s
+}